@@ -0,0 +1,206 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+// Command sum sums integers (one per line) from files or stdin with the chosen pkg/sum implementation.
+//
+// Example usage:
+//
+//	sum -function=ConcurrentSum3 -workers=8 dump1.txt dump2.txt
+//	cat dump.txt | sum -verify
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	stdlog "log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/examples/pkg/sum"
+)
+
+type sumFunc func(fileName string, workers int) (int64, error)
+
+func simple(f func(string) (int64, error)) sumFunc {
+	return func(fileName string, _ int) (int64, error) { return f(fileName) }
+}
+
+// implementations are all integer sum implementations by name.
+var implementations = map[string]sumFunc{
+	"Sum":                  simple(sum.Sum),
+	"Sum2":                 simple(sum.Sum2),
+	"Sum2_scanner":         simple(sum.Sum2_scanner),
+	"Sum3":                 simple(sum.Sum3),
+	"Sum4":                 simple(sum.Sum4),
+	"Sum4_atoi":            simple(sum.Sum4_atoi),
+	"Sum4_swar":            simple(sum.Sum4_swar),
+	"Sum5":                 simple(sum.Sum5),
+	"Sum5_line":            simple(sum.Sum5_line),
+	"Sum6":                 simple(sum.Sum6),
+	"Sum7":                 simple(sum.Sum7),
+	"SumAuto":              simple(sum.SumAuto),
+	"SumMmap":              simple(sum.SumMmap),
+	"SumChecked":           simple(sum.SumChecked),
+	"ConcurrentSum1":       simple(sum.ConcurrentSum1),
+	"ConcurrentSum2":       sum.ConcurrentSum2,
+	"ConcurrentSum3":       sum.ConcurrentSum3,
+	"ConcurrentSum4":       sum.ConcurrentSum4,
+	"ConcurrentSumMmap":    sum.ConcurrentSumMmap,
+	"ConcurrentSumChecked": sum.ConcurrentSumChecked,
+}
+
+func implementationNames() []string {
+	names := make([]string, 0, len(implementations))
+	for n := range implementations {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func main() {
+	if err := runMain(context.Background(), os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		// Use %+v for github.com/efficientgo/core/errors error to print with stack.
+		stdlog.Fatalf("Error: %+v", err)
+	}
+}
+
+func runMain(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) (err error) {
+	sumFlags := flag.NewFlagSet("sum", flag.ContinueOnError)
+	function := sumFlags.String("function", "Sum4", "The implementation to use, one of: "+strings.Join(implementationNames(), ", "))
+	workers := sumFlags.Int("workers", runtime.GOMAXPROCS(0), "The number of workers for ConcurrentSum* implementations.")
+	verify := sumFlags.Bool("verify", false, "Run all implementations and fail if any of them disagree or fail.")
+	sumFlags.Usage = func() {
+		_, _ = fmt.Fprintf(sumFlags.Output(), "Usage: sum [flags] [file ...]\nSums integers (one per line) from files or stdin (no files or \"-\").\n\n")
+		sumFlags.PrintDefaults()
+	}
+	if err := sumFlags.Parse(args); err != nil {
+		return err
+	}
+
+	names := []string{*function}
+	if *verify {
+		names = implementationNames()
+	} else if _, ok := implementations[*function]; !ok {
+		return errors.Newf("unknown function %v, expected one of: %v", *function, strings.Join(implementationNames(), ", "))
+	}
+	if *workers < 1 {
+		return errors.Newf("workers has to be positive, got %v", *workers)
+	}
+
+	files := sumFlags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	stdinFiles := 0
+	for _, file := range files {
+		if file == "-" {
+			stdinFiles++
+		}
+	}
+	if stdinFiles > 1 {
+		return errors.Newf("stdin (-) can be summed only once, got it %v times", stdinFiles)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	defer errcapture.Do(&err, tw.Flush, "flush output")
+	_, _ = fmt.Fprintln(tw, "FILE\tFUNCTION\tSUM\tDURATION\tALLOCS\tALLOC BYTES")
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := sumFile(file, names, *workers, stdin, tw, *verify); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sumFile sums the file with all given implementations and writes results to w. If verify is true, it fails if any
+// implementation fails or the results differ.
+func sumFile(file string, names []string, workers int, stdin io.Reader, w io.Writer, verify bool) (err error) {
+	fileName := file
+	if file == "-" {
+		// All implementations take file name, so stdin has to be buffered into a file.
+		fileName, err = stdinToFile(stdin)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(fileName) }()
+	}
+
+	var (
+		results  = map[int64][]string{}
+		failures []string
+	)
+	for _, name := range names {
+		ret, dur, allocs, allocBytes, err := measure(implementations[name], fileName, workers)
+		if err != nil {
+			if !verify {
+				return errors.Wrapf(err, "%v of %v", name, file)
+			}
+			_, _ = fmt.Fprintf(w, "%v\t%v\terror: %v\t%v\t%v\t%v\n", file, name, err, dur, allocs, allocBytes)
+			failures = append(failures, name)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", file, name, ret, dur, allocs, allocBytes)
+		results[ret] = append(results[ret], name)
+	}
+
+	if len(failures) > 0 {
+		return errors.Newf("verification of %v failed: %v failed", file, strings.Join(failures, ", "))
+	}
+	if len(results) > 1 {
+		var disagreements []string
+		for ret, names := range results {
+			disagreements = append(disagreements, fmt.Sprintf("%v returned %v", strings.Join(names, ", "), ret))
+		}
+		sort.Strings(disagreements)
+		return errors.Newf("verification of %v failed, implementations disagree: %v", file, strings.Join(disagreements, "; "))
+	}
+	return nil
+}
+
+// measure calls f and returns its result, duration and heap allocations done in the meantime. Allocations are
+// process wide, so they are accurate only if nothing else runs concurrently.
+func measure(f sumFunc, fileName string, workers int) (ret int64, dur time.Duration, allocs uint64, allocBytes uint64, err error) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	ret, err = f(fileName, workers)
+
+	dur = time.Since(start)
+	runtime.ReadMemStats(&after)
+	return ret, dur, after.Mallocs - before.Mallocs, after.TotalAlloc - before.TotalAlloc, err
+}
+
+// stdinToFile copies stdin into a temporary file and returns its name. The file is removed on error, otherwise it's
+// up to the caller.
+func stdinToFile(stdin io.Reader) (_ string, err error) {
+	f, err := os.CreateTemp("", "sum-stdin-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	defer errcapture.Do(&err, f.Close, "close stdin file")
+
+	if _, err := io.Copy(f, stdin); err != nil {
+		return "", errors.Wrap(err, "read stdin")
+	}
+	return f.Name(), nil
+}
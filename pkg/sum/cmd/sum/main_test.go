@@ -0,0 +1,108 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+)
+
+func createInput(t *testing.T, numLen int) (string, []byte, int64) {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	expected, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, numLen)
+	testutil.Ok(t, err)
+
+	fn := filepath.Join(t.TempDir(), "input.txt")
+	testutil.Ok(t, os.WriteFile(fn, buf.Bytes(), os.ModePerm))
+	return fn, buf.Bytes(), expected
+}
+
+func TestRunMain(t *testing.T) {
+	ctx := context.Background()
+	fn, input, expected := createInput(t, 1e4)
+
+	t.Run("file", func(t *testing.T) {
+		out := bytes.Buffer{}
+		testutil.Ok(t, runMain(ctx, []string{"-function=ConcurrentSum3", "-workers=3", fn, fn}, nil, &out))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		testutil.Equals(t, 3, len(lines))
+		for _, l := range lines[1:] {
+			fields := strings.Fields(l)
+			testutil.Equals(t, []string{fn, "ConcurrentSum3", fmt.Sprintf("%v", expected)}, fields[:3])
+		}
+	})
+	t.Run("stdin", func(t *testing.T) {
+		out := bytes.Buffer{}
+		testutil.Ok(t, runMain(ctx, []string{"-function=Sum6"}, bytes.NewReader(input), &out))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		testutil.Equals(t, 2, len(lines))
+		testutil.Equals(t, []string{"-", "Sum6", fmt.Sprintf("%v", expected)}, strings.Fields(lines[1])[:3])
+	})
+	t.Run("stdin more than once", func(t *testing.T) {
+		testutil.NotOk(t, runMain(ctx, []string{"-function=Sum6", "-", fn, "-"}, bytes.NewReader(input), &bytes.Buffer{}))
+	})
+	t.Run("verify", func(t *testing.T) {
+		out := bytes.Buffer{}
+		testutil.Ok(t, runMain(ctx, []string{"-verify", fn}, nil, &out))
+
+		// Header and all implementations.
+		testutil.Equals(t, len(implementations)+1, len(strings.Split(strings.TrimSpace(out.String()), "\n")))
+	})
+	t.Run("unknown function", func(t *testing.T) {
+		testutil.NotOk(t, runMain(ctx, []string{"-function=Sum100", fn}, nil, &bytes.Buffer{}))
+	})
+	t.Run("invalid input", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid.txt")
+		testutil.Ok(t, os.WriteFile(invalid, []byte("1\n12a4\n"), os.ModePerm))
+
+		testutil.NotOk(t, runMain(ctx, []string{invalid}, nil, &bytes.Buffer{}))
+		testutil.NotOk(t, runMain(ctx, []string{"-verify", invalid}, nil, &bytes.Buffer{}))
+	})
+}
+
+func TestStdinToFile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	fileName, err := stdinToFile(strings.NewReader("1\n2\n"))
+	testutil.Ok(t, err)
+	b, err := os.ReadFile(fileName)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "1\n2\n", string(b))
+	testutil.Ok(t, os.Remove(fileName))
+
+	// Temporary file is removed on error.
+	_, err = stdinToFile(io.MultiReader(strings.NewReader("1\n"), iotest.ErrReader(errors.New("read failed"))))
+	testutil.NotOk(t, err)
+	entries, err := os.ReadDir(tmp)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(entries))
+}
+
+func TestRunMain_VerifyDisagreement(t *testing.T) {
+	fn, _, _ := createInput(t, 10)
+
+	implementations["broken"] = func(string, int) (int64, error) { return 42, nil }
+	t.Cleanup(func() { delete(implementations, "broken") })
+
+	out := bytes.Buffer{}
+	err := runMain(context.Background(), []string{"-verify", fn}, nil, &out)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "broken returned 42"), err.Error())
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/efficientgo/core/errcapture"
+)
+
+// WriteJSONFile writes v as JSON to the file. It writes to a temporary file in the same directory first and renames
+// it, so the process crashing in the middle does not leave a corrupted file.
+func WriteJSONFile(file string, v any) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := func() (err error) {
+		defer errcapture.Do(&err, f.Close, "close temporary file")
+		return json.NewEncoder(f).Encode(v)
+	}(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestWriteJSONFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.json")
+
+	testutil.Ok(t, WriteJSONFile(file, []int{1, 2}))
+	testutil.Ok(t, WriteJSONFile(file, []int{3}))
+
+	b, err := os.ReadFile(file)
+	testutil.Ok(t, err)
+	var v []int
+	testutil.Ok(t, json.Unmarshal(b, &v))
+	testutil.Equals(t, []int{3}, v)
+
+	// Failures don't leave temporary files behind.
+	testutil.NotOk(t, WriteJSONFile(file, func() {}))
+	files, err := os.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(files))
+
+	testutil.NotOk(t, WriteJSONFile(filepath.Join(dir, "missing", "a.json"), 1))
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+// Package cache contains building blocks of caches in the sum package and its tools.
+package cache
+
+import "container/list"
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// LRU is a map holding up to maxEntries values, evicting the least recently used ones. It is not safe for concurrent
+// use, callers have to synchronize it.
+type LRU[K comparable, V any] struct {
+	maxEntries int
+	onEvict    func(K, V)
+
+	ll      *list.List // Of *lruEntry[K, V], the most recently used in front.
+	entries map[K]*list.Element
+}
+
+// NewLRU returns LRU for up to maxEntries values. If onEvict is not nil, it's called with every evicted entry.
+func NewLRU[K comparable, V any](maxEntries int, onEvict func(K, V)) *LRU[K, V] {
+	return &LRU[K, V]{
+		maxEntries: maxEntries,
+		onEvict:    onEvict,
+		ll:         list.New(),
+		entries:    map[K]*list.Element{},
+	}
+}
+
+// Get returns the value and marks it as the most recently used.
+func (c *LRU[K, V]) Get(k K) (V, bool) {
+	e, ok := c.entries[k]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry[K, V]).value, true
+}
+
+// Add adds (or replaces) the value as the most recently used and evicts the least recently used ones over the limit.
+func (c *LRU[K, V]) Add(k K, v V) {
+	if e, ok := c.entries[k]; ok {
+		e.Value.(*lruEntry[K, V]).value = v
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.entries[k] = c.ll.PushFront(&lruEntry[K, V]{key: k, value: v})
+	for c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Remove(c.ll.Back()).(*lruEntry[K, V])
+		delete(c.entries, oldest.key)
+		if c.onEvict != nil {
+			c.onEvict(oldest.key, oldest.value)
+		}
+	}
+}
+
+// Len returns number of values.
+func (c *LRU[K, V]) Len() int {
+	return c.ll.Len()
+}
+
+// Range calls f for all entries, from the most recently used, until f returns false. It does not change the order.
+func (c *LRU[K, V]) Range(f func(K, V) bool) {
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*lruEntry[K, V])
+		if !f(entry.key, entry.value) {
+			return
+		}
+	}
+}
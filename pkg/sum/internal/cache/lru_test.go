@@ -0,0 +1,69 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func keys(c *LRU[string, int]) []string {
+	var ret []string
+	c.Range(func(k string, _ int) bool {
+		ret = append(ret, k)
+		return true
+	})
+	return ret
+}
+
+func TestLRU(t *testing.T) {
+	var evicted []string
+	c := NewLRU[string, int](2, func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+
+	_, ok := c.Get("a")
+	testutil.Assert(t, !ok)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	testutil.Equals(t, []string{"b", "a"}, keys(c))
+
+	// Get marks value as the most recently used, so b is evicted.
+	v, ok := c.Get("a")
+	testutil.Assert(t, ok)
+	testutil.Equals(t, 1, v)
+	c.Add("c", 3)
+	testutil.Equals(t, []string{"c", "a"}, keys(c))
+	testutil.Equals(t, []string{"b"}, evicted)
+	_, ok = c.Get("b")
+	testutil.Assert(t, !ok)
+
+	// Replaced value is not evicted.
+	c.Add("a", 10)
+	v, _ = c.Get("a")
+	testutil.Equals(t, 10, v)
+	testutil.Equals(t, 2, c.Len())
+	testutil.Equals(t, []string{"b"}, evicted)
+
+	c.Add("d", 4)
+	testutil.Equals(t, []string{"d", "a"}, keys(c))
+	testutil.Equals(t, []string{"b", "c"}, evicted)
+
+	t.Run("range stops", func(t *testing.T) {
+		var visited int
+		c.Range(func(string, int) bool {
+			visited++
+			return false
+		})
+		testutil.Equals(t, 1, visited)
+	})
+	t.Run("without eviction callback", func(t *testing.T) {
+		c := NewLRU[string, int](1, nil)
+		c.Add("a", 1)
+		c.Add("b", 2)
+		testutil.Equals(t, []string{"b"}, keys(c))
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/efficientgo/core/errors"
+)
+
+const (
+	// maxBatchSize is the maximum number of objects in a single batch request.
+	maxBatchSize = 10e3
+	// maxBatchBodySize is the maximum size of the JSON batch request body.
+	maxBatchBodySize = 10 * 1024 * 1024
+)
+
+// labelObjectsRequest is the JSON body of the batch request.
+type labelObjectsRequest struct {
+	ObjectIDs []string `json:"object_ids"`
+	// CheckSum is the checksum algorithm used for all objects. Empty means the default algorithm.
+	CheckSum string `json:"checksum"`
+	// SchemaVersion is the label schema version used for all objects. Empty means the default version.
+	SchemaVersion string `json:"schema_version"`
+}
+
+// labelResult is the result of labeling a single object. Label is nil, if labeling failed. It's not encoded itself,
+// the handler writes the label in the requested schema version or labelError instead.
+type labelResult struct {
+	ObjID string
+	*label
+	Error string
+	// RetryAfter is in seconds, non zero if the object failed because labeler was overloaded.
+	RetryAfter int
+}
+
+// labelError is a single line of the batch response for failed object. Successful objects are reported as labels
+// in the requested schema version.
+type labelError struct {
+	ObjID string `json:"object_id"`
+	Error string `json:"error"`
+	// RetryAfter is set if labeler was overloaded, like Retry-After header of 429 response (in seconds).
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// parseLabelObjectsRequest returns the request from JSON body (if content type is application/json) or form values.
+func parseLabelObjectsRequest(r *http.Request) (labelObjectsRequest, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req labelObjectsRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBodySize)).Decode(&req); err != nil {
+			return labelObjectsRequest{}, errors.Wrap(err, "decode JSON body")
+		}
+		return req, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return labelObjectsRequest{}, err
+	}
+	return labelObjectsRequest{
+		ObjectIDs:     r.Form["object_id"],
+		CheckSum:      r.Form.Get("checksum"),
+		SchemaVersion: r.Form.Get("schema_version"),
+	}, nil
+}
+
+// labelObjectsHandler labels all objects from the request, with at most parallelism objects labeled at the same time.
+// Results are streamed as NDJSON in the order of completion, one line per object: the label in the requested schema
+// version or labelError. Failure of a single object is reported in its line, it does not fail the whole batch.
+func labelObjectsHandler(labelFn labelFunc, parallelism int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+
+		req, err := parseLabelObjectsRequest(r)
+		if err != nil {
+			httpErrHandle(w, http.StatusBadRequest, err)
+			return
+		}
+		alg, err := parseChecksumAlgorithm(req.CheckSum)
+		if err != nil {
+			httpErrHandle(w, http.StatusBadRequest, err)
+			return
+		}
+		version, err := parseLabelSchemaVersion(req.SchemaVersion)
+		if err != nil {
+			httpErrHandle(w, http.StatusBadRequest, err)
+			return
+		}
+		objectIDs := req.ObjectIDs
+		if len(objectIDs) == 0 {
+			httpErrHandle(w, http.StatusBadRequest, errors.New("at least one object_id is required"))
+			return
+		}
+		if len(objectIDs) > maxBatchSize {
+			httpErrHandle(w, http.StatusBadRequest, errors.Newf("too many objects %v, at most %v are allowed", len(objectIDs), maxBatchSize))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+
+		enc := json.NewEncoder(w) // Encode terminates each value with newline.
+		ctx := withLabelSchemaVersion(withChecksumAlgorithm(r.Context(), alg), version)
+		for res := range labelObjects(ctx, labelFn, objectIDs, parallelism) {
+			var v any = labelError{ObjID: res.ObjID, Error: res.Error, RetryAfter: res.RetryAfter}
+			if res.label != nil {
+				v = res.label.versioned(version)
+			}
+			if err := enc.Encode(v); err != nil {
+				// Client is gone, request context is canceled, so remaining objects fail fast.
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// labelObjects labels objects concurrently, with at most parallelism objects at the same time, and sends their
+// results as they complete. The channel is closed after all results are sent. It's buffered for all results, so
+// workers never block, even if nobody reads the results anymore.
+func labelObjects(ctx context.Context, labelFn labelFunc, objectIDs []string, parallelism int) <-chan labelResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if parallelism > len(objectIDs) {
+		parallelism = len(objectIDs)
+	}
+
+	var (
+		idCh     = make(chan string, len(objectIDs))
+		resultCh = make(chan labelResult, len(objectIDs))
+		wg       sync.WaitGroup
+	)
+	for _, id := range objectIDs {
+		idCh <- id
+	}
+	close(idCh)
+
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+
+			for id := range idCh {
+				if err := ctx.Err(); err != nil {
+					resultCh <- labelResult{ObjID: id, Error: err.Error()}
+					continue
+				}
+				lbl, err := labelFn(ctx, id)
+				if err != nil {
+					res := labelResult{ObjID: id, Error: err.Error()}
+					var oerr *overloadedError
+					if errors.As(err, &oerr) {
+						res.RetryAfter = oerr.retryAfterSeconds()
+					}
+					resultCh <- res
+					continue
+				}
+				resultCh <- labelResult{ObjID: id, label: &lbl}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+	return resultCh
+}
@@ -0,0 +1,226 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+	"github.com/thanos-io/objstore"
+)
+
+// batchTestResult is a line of the batch response (label or labelError) as seen by the client. Sum is nil if label
+// is missing.
+type batchTestResult struct {
+	ObjID string `json:"object_id"`
+	Sum   *int64 `json:"sum"`
+	Error string `json:"error"`
+	// RetryAfter is 0 if it's missing.
+	RetryAfter int `json:"retry_after"`
+}
+
+func readResults(t *testing.T, res *http.Response) []batchTestResult {
+	t.Helper()
+
+	testutil.Equals(t, http.StatusOK, res.StatusCode)
+	testutil.Equals(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+
+	var results []batchTestResult
+	s := bufio.NewScanner(res.Body)
+	for s.Scan() {
+		var r batchTestResult
+		testutil.Ok(t, json.Unmarshal(s.Bytes(), &r), s.Text())
+		results = append(results, r)
+	}
+	testutil.Ok(t, s.Err())
+	sort.Slice(results, func(i, j int) bool { return results[i].ObjID < results[j].ObjID })
+	return results
+}
+
+func TestLabelObjectsHandler(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	expected := map[string]int64{}
+	for _, id := range []string{"a.txt", "b.txt", "c.txt"} {
+		buf := bytes.Buffer{}
+		exp, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e3*(len(expected)+1))
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, id, &buf))
+		expected[id] = exp
+	}
+	testutil.Ok(t, bkt.Upload(ctx, "invalid.txt", strings.NewReader("1\n12a4\n")))
+
+	l := &labeler{bkt: bkt}
+	srv := httptest.NewServer(labelObjectsHandler(l.labelObject1, 2))
+	t.Cleanup(srv.Close)
+
+	check := func(t *testing.T, results []batchTestResult) {
+		t.Helper()
+
+		testutil.Equals(t, 5, len(results))
+		for _, r := range results[:3] {
+			testutil.Equals(t, "", r.Error)
+			testutil.Assert(t, r.Sum != nil)
+			testutil.Equals(t, expected[r.ObjID], *r.Sum)
+		}
+		testutil.Equals(t, "invalid.txt", results[3].ObjID)
+		testutil.Assert(t, strings.Contains(results[3].Error, "not a valid integer"), results[3].Error)
+		testutil.Assert(t, results[3].Sum == nil)
+		testutil.Equals(t, "missing.txt", results[4].ObjID)
+		testutil.Assert(t, results[4].Error != "")
+	}
+	ids := []string{"b.txt", "missing.txt", "a.txt", "invalid.txt", "c.txt"}
+
+	t.Run("form", func(t *testing.T) {
+		res, err := http.PostForm(srv.URL, url.Values{"object_id": ids})
+		testutil.Ok(t, err)
+		defer func() { _ = res.Body.Close() }()
+		check(t, readResults(t, res))
+	})
+	t.Run("query", func(t *testing.T) {
+		res, err := http.Get(srv.URL + "?" + url.Values{"object_id": ids}.Encode())
+		testutil.Ok(t, err)
+		defer func() { _ = res.Body.Close() }()
+		check(t, readResults(t, res))
+	})
+	t.Run("json", func(t *testing.T) {
+		b, err := json.Marshal(labelObjectsRequest{ObjectIDs: ids})
+		testutil.Ok(t, err)
+		res, err := http.Post(srv.URL, "application/json", bytes.NewReader(b))
+		testutil.Ok(t, err)
+		defer func() { _ = res.Body.Close() }()
+		check(t, readResults(t, res))
+	})
+	t.Run("bad requests", func(t *testing.T) {
+		for _, tcase := range []struct {
+			contentType, body string
+		}{
+			{contentType: "application/x-www-form-urlencoded", body: ""},
+			{contentType: "application/json", body: `{"object_ids": []}`},
+			{contentType: "application/json", body: `{"object_ids": [`},
+			{contentType: "application/x-www-form-urlencoded", body: strings.Repeat("object_id=a&", maxBatchSize+1)},
+		} {
+			res, err := http.Post(srv.URL, tcase.contentType, strings.NewReader(tcase.body))
+			testutil.Ok(t, err)
+			_ = res.Body.Close()
+			testutil.Equals(t, http.StatusBadRequest, res.StatusCode, tcase.body)
+		}
+	})
+}
+
+func TestLabelObjectsHandler_Overloaded(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(context.Background(), "a.txt", strings.NewReader("1\n2\n")))
+
+	l := &labeler{bkt: bkt}
+	labelFn := func(ctx context.Context, objID string) (label, error) {
+		if objID == "busy.txt" {
+			return label{}, errors.Wrap(&overloadedError{reason: "busy", RetryAfter: 1500 * time.Millisecond}, "label")
+		}
+		return l.labelObject1(ctx, objID)
+	}
+	srv := httptest.NewServer(labelObjectsHandler(labelFn, 2))
+	t.Cleanup(srv.Close)
+
+	res, err := http.PostForm(srv.URL, url.Values{"object_id": {"a.txt", "busy.txt", "missing.txt"}})
+	testutil.Ok(t, err)
+	defer func() { _ = res.Body.Close() }()
+
+	results := readResults(t, res)
+	testutil.Equals(t, 3, len(results))
+	testutil.Equals(t, "", results[0].Error)
+	testutil.Equals(t, 0, results[0].RetryAfter)
+	testutil.Equals(t, "busy.txt", results[1].ObjID)
+	testutil.Assert(t, strings.Contains(results[1].Error, "overloaded"), results[1].Error)
+	testutil.Equals(t, 2, results[1].RetryAfter)
+	testutil.Equals(t, "missing.txt", results[2].ObjID)
+	testutil.Assert(t, results[2].Error != "")
+	testutil.Equals(t, 0, results[2].RetryAfter)
+}
+
+func TestLabelObjects_Parallelism(t *testing.T) {
+	var running, maxRunning atomic.Int64
+	labelFn := func(ctx context.Context, objID string) (label, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			if m := maxRunning.Load(); n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		if objID == "fail" {
+			return label{}, errors.New("failed")
+		}
+		return label{ObjID: objID, Sum: int64(len(objID))}, nil
+	}
+
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = strings.Repeat("x", i)
+	}
+	ids[50] = "fail"
+
+	var results []labelResult
+	for r := range labelObjects(context.Background(), labelFn, ids, 3) {
+		results = append(results, r)
+	}
+	testutil.Equals(t, len(ids), len(results))
+	testutil.Assert(t, maxRunning.Load() <= 3, "max running %v", maxRunning.Load())
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+			testutil.Equals(t, "fail", r.ObjID)
+			continue
+		}
+		testutil.Equals(t, int64(len(r.ObjID)), r.Sum)
+	}
+	testutil.Equals(t, 1, failed)
+}
+
+func TestLabelObjectsHandler_Streaming(t *testing.T) {
+	unblock := make(chan struct{})
+	labelFn := func(ctx context.Context, objID string) (label, error) {
+		if objID == "slow" {
+			select {
+			case <-unblock:
+			case <-ctx.Done():
+				return label{}, ctx.Err()
+			}
+		}
+		return label{ObjID: objID}, nil
+	}
+	srv := httptest.NewServer(labelObjectsHandler(labelFn, 2))
+	t.Cleanup(srv.Close)
+
+	res, err := http.PostForm(srv.URL, url.Values{"object_id": {"slow", "fast"}})
+	testutil.Ok(t, err)
+	defer func() { _ = res.Body.Close() }()
+
+	// Result of the fast object is streamed, while the slow one is still being labeled.
+	r := bufio.NewReader(res.Body)
+	line, err := r.ReadBytes('\n')
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"object_id":"fast","sum":0,"checksum":null}`+"\n", string(line))
+
+	close(unblock)
+	line, err = r.ReadBytes('\n')
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"object_id":"slow","sum":0,"checksum":null}`+"\n", string(line))
+}
@@ -0,0 +1,247 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/examples/pkg/sum/internal/cache"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+)
+
+// labelCacheKey identifies the requested label of the object version. Object storage sets the last modified time on
+// every upload, so the key of the overwritten object changes.
+type labelCacheKey struct {
+	ObjID         string             `json:"object_id"`
+	Size          int64              `json:"size"`
+	LastModified  int64              `json:"last_modified_ns"`
+	CheckSum      checksumAlgorithm  `json:"checksum_algorithm"`
+	SchemaVersion labelSchemaVersion `json:"schema_version"`
+}
+
+func newLabelCacheKey(ctx context.Context, objID string, a objstore.ObjectAttributes) labelCacheKey {
+	return labelCacheKey{
+		ObjID:         objID,
+		Size:          a.Size,
+		LastModified:  a.LastModified.UnixNano(),
+		CheckSum:      checksumAlgorithmFromContext(ctx),
+		SchemaVersion: labelSchemaVersionFromContext(ctx),
+	}
+}
+
+// fileName returns the name of the file in the persistent tier. Object IDs can contain '/' and other characters not
+// safe for file names, so the key is hashed.
+func (k labelCacheKey) fileName() string {
+	b, _ := json.Marshal(k) // Marshaling struct of strings and integers can't fail.
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]) + ".json"
+}
+
+type labelCacheEntry struct {
+	labelCacheKey
+	Label label `json:"label"`
+}
+
+// labelCache keeps labels of recently requested objects, so unchanged objects are not downloaded and parsed again.
+// It is safe for concurrent use. Optionally, labels are stored in the directory too, one JSON file per cached label,
+// so restarted labeler starts with warm cache. The directory mirrors the memory, files of evicted labels are removed.
+type labelCache struct {
+	bkt    objstore.BucketReader
+	logger log.Logger
+	// dir is empty if cache is not persisted.
+	dir string
+
+	mu  sync.Mutex
+	lru *cache.LRU[labelCacheKey, label]
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+// newLabelCache returns the cache for up to maxEntries labels of objects from the bucket. If dir is not empty, labels
+// are persisted in it and the ones stored before are loaded. Cache failing to load them starts empty. Metrics are
+// registered on reg, if not nil.
+func newLabelCache(logger log.Logger, reg prometheus.Registerer, bkt objstore.BucketReader, maxEntries int, dir string) (*labelCache, error) {
+	if maxEntries < 1 {
+		return nil, errors.Newf("cache has to have at least one entry, got %v", maxEntries)
+	}
+
+	c := &labelCache{
+		bkt:    bkt,
+		logger: logger,
+		dir:    dir,
+		hits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "labeler_cache_hits_total",
+			Help: "Total number of labels returned from the cache.",
+		}),
+		misses: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "labeler_cache_misses_total",
+			Help: "Total number of labels not found in the cache, so computed from the object.",
+		}),
+	}
+	if dir == "" {
+		c.lru = cache.NewLRU[labelCacheKey, label](maxEntries, nil)
+		return c, nil
+	}
+
+	c.lru = cache.NewLRU(maxEntries, func(k labelCacheKey, _ label) {
+		c.removeFile(filepath.Join(c.dir, k.fileName()))
+	})
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "create cache dir")
+	}
+	if err := c.loadDir(); err != nil {
+		level.Warn(c.logger).Log("msg", "failed to load cached labels, starting with empty cache", "dir", dir, "err", err)
+	}
+	return c, nil
+}
+
+// wrap returns labelFunc serving labels from the cache. Objects which are not cached yet or which have changed are
+// labeled with labelFn. Requests for the same object arriving before its label is cached all call labelFn.
+func (c *labelCache) wrap(labelFn labelFunc) labelFunc {
+	return func(ctx context.Context, objID string) (label, error) {
+		a, err := c.bkt.Attributes(ctx, objID)
+		if err != nil {
+			return label{}, err
+		}
+		k := newLabelCacheKey(ctx, objID, a)
+
+		if lbl, ok := c.get(k); ok {
+			c.hits.Inc()
+			return lbl, nil
+		}
+		c.misses.Inc()
+
+		lbl, err := labelFn(ctx, objID)
+		if err != nil {
+			return label{}, err
+		}
+
+		// Label of the object overwritten during labelFn can be of either version, so it's returned, but not cached.
+		if after, err := c.bkt.Attributes(ctx, objID); err != nil || newLabelCacheKey(ctx, objID, after) != k {
+			return lbl, nil
+		}
+
+		// Store first, so the label evicted right after it's added never leaves its file behind. Label which failed
+		// to persist is still fine to return and keep in memory.
+		if err := c.store(k, lbl); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to persist label", "object", objID, "err", err)
+		}
+		c.add(k, lbl)
+		return lbl, nil
+	}
+}
+
+// Len returns number of cached labels.
+func (c *labelCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *labelCache) get(k labelCacheKey) (label, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Get(k)
+}
+
+func (c *labelCache) add(k labelCacheKey, lbl label) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Add(k, lbl)
+}
+
+// store writes the label to the persistent tier, if any.
+func (c *labelCache) store(k labelCacheKey, lbl label) error {
+	if c.dir == "" {
+		return nil
+	}
+	return cache.WriteJSONFile(filepath.Join(c.dir, k.fileName()), labelCacheEntry{labelCacheKey: k, Label: lbl})
+}
+
+// isLabelCacheFile returns true for names of label files and their temporary files, so other files in the directory
+// are never removed.
+func isLabelCacheFile(name string) bool {
+	return strings.HasSuffix(name, ".json") || strings.Contains(name, ".json.tmp-")
+}
+
+// loadDir adds labels from the directory, in the order they were stored. Files of the oldest labels over the limit
+// are removed by eviction, as well as invalid ones (e.g. temporary files of interrupted writes).
+func (c *labelCache) loadDir() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type storedEntry struct {
+		labelCacheEntry
+		modTime time.Time
+	}
+	var entries []storedEntry
+	for _, f := range files {
+		if !f.Type().IsRegular() || !isLabelCacheFile(f.Name()) {
+			continue
+		}
+		file := filepath.Join(c.dir, f.Name())
+		entry, err := readLabelCacheFile(file)
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "removing invalid label cache file", "file", file, "err", err)
+			c.removeFile(file)
+			continue
+		}
+		fi, err := f.Info()
+		if err != nil {
+			// Removed in the meantime.
+			continue
+		}
+		entries = append(entries, storedEntry{labelCacheEntry: entry, modTime: fi.ModTime()})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		c.lru.Add(e.labelCacheKey, e.Label)
+	}
+	level.Info(c.logger).Log("msg", "loaded cached labels", "dir", c.dir, "labels", c.lru.Len())
+	return nil
+}
+
+// readLabelCacheFile returns the entry from the file, if the file name matches its key.
+func readLabelCacheFile(file string) (labelCacheEntry, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return labelCacheEntry{}, err
+	}
+
+	var entry labelCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return labelCacheEntry{}, errors.Wrap(err, "decode")
+	}
+	if entry.fileName() != filepath.Base(file) {
+		return labelCacheEntry{}, errors.Newf("expected file name %v for the key", entry.fileName())
+	}
+	return entry, nil
+}
+
+func (c *labelCache) removeFile(file string) {
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		level.Warn(c.logger).Log("msg", "failed to remove label cache file", "file", file, "err", err)
+	}
+}
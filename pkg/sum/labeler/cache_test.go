@@ -0,0 +1,189 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/objstore"
+)
+
+func TestLabelCache(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "a.txt", strings.NewReader("1\n2\n")))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/b.txt", strings.NewReader("10\n20\n")))
+	testutil.Ok(t, bkt.Upload(ctx, "invalid.txt", strings.NewReader("1\n12a4\n")))
+
+	var calls atomic.Int64
+	l := &labeler{bkt: bkt}
+	labelFn := func(ctx context.Context, objID string) (label, error) {
+		calls.Add(1)
+		return l.labelObject1(ctx, objID)
+	}
+
+	checkLabel := func(t *testing.T, f labelFunc, objID string, expected int64) {
+		t.Helper()
+
+		lbl, err := f(ctx, objID)
+		testutil.Ok(t, err)
+		testutil.Equals(t, objID, lbl.ObjID)
+		testutil.Equals(t, expected, lbl.Sum)
+	}
+
+	t.Run("in-memory", func(t *testing.T) {
+		calls.Store(0)
+		reg := prometheus.NewRegistry()
+		c, err := newLabelCache(log.NewNopLogger(), reg, bkt, 1, "")
+		testutil.Ok(t, err)
+		f := c.wrap(labelFn)
+
+		checkLabel(t, f, "a.txt", 3)
+		checkLabel(t, f, "a.txt", 3)
+		testutil.Equals(t, int64(1), calls.Load())
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(c.hits))
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(c.misses))
+
+		// Only one entry fits, so a.txt is evicted.
+		checkLabel(t, f, "dir/b.txt", 30)
+		checkLabel(t, f, "a.txt", 3)
+		testutil.Equals(t, int64(3), calls.Load())
+		testutil.Equals(t, 1, c.Len())
+
+		// Errors are not cached.
+		_, err = f(ctx, "invalid.txt")
+		testutil.NotOk(t, err)
+		_, err = f(ctx, "invalid.txt")
+		testutil.NotOk(t, err)
+		testutil.Equals(t, int64(5), calls.Load())
+		_, err = f(ctx, "missing.txt")
+		testutil.NotOk(t, err)
+		testutil.Equals(t, int64(5), calls.Load())
+		testutil.Equals(t, 5.0, promtestutil.ToFloat64(c.misses))
+	})
+	t.Run("object changed", func(t *testing.T) {
+		calls.Store(0)
+		c, err := newLabelCache(log.NewNopLogger(), nil, bkt, 10, "")
+		testutil.Ok(t, err)
+		f := c.wrap(labelFn)
+
+		testutil.Ok(t, bkt.Upload(ctx, "changed.txt", strings.NewReader("1\n")))
+		checkLabel(t, f, "changed.txt", 1)
+		checkLabel(t, f, "changed.txt", 1)
+		testutil.Equals(t, int64(1), calls.Load())
+
+		testutil.Ok(t, bkt.Upload(ctx, "changed.txt", strings.NewReader("1\n2\n3\n")))
+		checkLabel(t, f, "changed.txt", 6)
+		checkLabel(t, f, "changed.txt", 6)
+		testutil.Equals(t, int64(2), calls.Load())
+	})
+	t.Run("persistent", func(t *testing.T) {
+		calls.Store(0)
+		dir := t.TempDir()
+
+		c, err := newLabelCache(log.NewNopLogger(), nil, bkt, 10, dir)
+		testutil.Ok(t, err)
+		checkLabel(t, c.wrap(labelFn), "a.txt", 3)
+		checkLabel(t, c.wrap(labelFn), "dir/b.txt", 30)
+		testutil.Equals(t, int64(2), calls.Load())
+
+		files, err := os.ReadDir(dir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 2, len(files))
+
+		// New cache (e.g. after restart) starts with labels from the directory.
+		reg := prometheus.NewRegistry()
+		c, err = newLabelCache(log.NewNopLogger(), reg, bkt, 10, dir)
+		testutil.Ok(t, err)
+		f := c.wrap(labelFn)
+		checkLabel(t, f, "a.txt", 3)
+		checkLabel(t, f, "a.txt", 3)
+		checkLabel(t, f, "dir/b.txt", 30)
+		testutil.Equals(t, int64(2), calls.Load())
+		testutil.Equals(t, 2, c.Len())
+		testutil.Equals(t, 3.0, promtestutil.ToFloat64(c.hits))
+		testutil.Equals(t, 0.0, promtestutil.ToFloat64(c.misses))
+	})
+	t.Run("persistent, bounded", func(t *testing.T) {
+		calls.Store(0)
+		dir := t.TempDir()
+		listFiles := func(t *testing.T) []string {
+			t.Helper()
+
+			files, err := os.ReadDir(dir)
+			testutil.Ok(t, err)
+			var names []string
+			for _, f := range files {
+				names = append(names, f.Name())
+			}
+			return names
+		}
+		keyOf := func(t *testing.T, objID string) labelCacheKey {
+			t.Helper()
+
+			a, err := bkt.Attributes(ctx, objID)
+			testutil.Ok(t, err)
+			return newLabelCacheKey(ctx, objID, a)
+		}
+
+		// Files of evicted labels are removed.
+		c, err := newLabelCache(log.NewNopLogger(), nil, bkt, 1, dir)
+		testutil.Ok(t, err)
+		checkLabel(t, c.wrap(labelFn), "a.txt", 3)
+		checkLabel(t, c.wrap(labelFn), "dir/b.txt", 30)
+		testutil.Equals(t, []string{keyOf(t, "dir/b.txt").fileName()}, listFiles(t))
+
+		c, err = newLabelCache(log.NewNopLogger(), nil, bkt, 2, dir)
+		testutil.Ok(t, err)
+		checkLabel(t, c.wrap(labelFn), "a.txt", 3)
+		testutil.Equals(t, int64(3), calls.Load())
+		testutil.Equals(t, 2, len(listFiles(t)))
+
+		// Restarted with smaller limit keeps the most recently stored labels and removes the rest.
+		older := time.Now().Add(-time.Hour)
+		testutil.Ok(t, os.Chtimes(filepath.Join(dir, keyOf(t, "dir/b.txt").fileName()), older, older))
+		// Invalid files are removed, files which are not from the cache stay.
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, "corrupted.json"), []byte("{"), os.ModePerm))
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, keyOf(t, "a.txt").fileName()+".tmp-123"), []byte("{"), os.ModePerm))
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("cache"), os.ModePerm))
+
+		c, err = newLabelCache(log.NewNopLogger(), nil, bkt, 1, dir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, c.Len())
+		expected := []string{keyOf(t, "a.txt").fileName(), "README.txt"}
+		sort.Strings(expected)
+		testutil.Equals(t, expected, listFiles(t))
+		checkLabel(t, c.wrap(labelFn), "a.txt", 3)
+		testutil.Equals(t, int64(3), calls.Load())
+	})
+	t.Run("failed persist", func(t *testing.T) {
+		calls.Store(0)
+		dir := filepath.Join(t.TempDir(), "cache")
+		c, err := newLabelCache(log.NewNopLogger(), nil, bkt, 10, dir)
+		testutil.Ok(t, err)
+		testutil.Ok(t, os.RemoveAll(dir))
+
+		// Label is still returned and cached in memory.
+		f := c.wrap(labelFn)
+		checkLabel(t, f, "a.txt", 3)
+		checkLabel(t, f, "a.txt", 3)
+		testutil.Equals(t, int64(1), calls.Load())
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(c.hits))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := newLabelCache(log.NewNopLogger(), nil, bkt, 0, "")
+		testutil.NotOk(t, err)
+	})
+}
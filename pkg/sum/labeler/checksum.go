@@ -0,0 +1,66 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/efficientgo/core/errors"
+)
+
+// checksumAlgorithm is the hash algorithm used for label checksum.
+type checksumAlgorithm string
+
+const (
+	checksumSHA256 checksumAlgorithm = "sha256"
+	checksumCRC32C checksumAlgorithm = "crc32c"
+	checksumXXHash checksumAlgorithm = "xxhash"
+
+	defaultChecksumAlgorithm = checksumSHA256
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// parseChecksumAlgorithm returns the algorithm by name. Empty name means the default algorithm.
+func parseChecksumAlgorithm(name string) (checksumAlgorithm, error) {
+	switch alg := checksumAlgorithm(name); alg {
+	case "":
+		return defaultChecksumAlgorithm, nil
+	case checksumSHA256, checksumCRC32C, checksumXXHash:
+		return alg, nil
+	default:
+		return "", errors.Newf("unknown checksum algorithm %q, expected %v, %v or %v", name, checksumSHA256, checksumCRC32C, checksumXXHash)
+	}
+}
+
+func (alg checksumAlgorithm) newHash() hash.Hash {
+	switch alg {
+	case checksumCRC32C:
+		return crc32.New(crc32cTable)
+	case checksumXXHash:
+		return xxhash.New()
+	default:
+		return sha256.New()
+	}
+}
+
+type checksumAlgorithmKey struct{}
+
+// withChecksumAlgorithm returns context making labelFunc compute checksum with the given algorithm. The algorithm is
+// selected per request, so it's passed in context, the same way as request deadline.
+func withChecksumAlgorithm(ctx context.Context, alg checksumAlgorithm) context.Context {
+	return context.WithValue(ctx, checksumAlgorithmKey{}, alg)
+}
+
+// checksumAlgorithmFromContext returns the algorithm set by withChecksumAlgorithm or the default one.
+func checksumAlgorithmFromContext(ctx context.Context) checksumAlgorithm {
+	if alg, ok := ctx.Value(checksumAlgorithmKey{}).(checksumAlgorithm); ok {
+		return alg
+	}
+	return defaultChecksumAlgorithm
+}
@@ -0,0 +1,133 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+	"github.com/gobwas/pool/pbytes"
+	"github.com/klauspost/compress/gzip"
+	"github.com/thanos-io/objstore"
+)
+
+func TestLabelObject_CheckSum(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	plain := bytes.Buffer{}
+	exp, err := sumtestutil.CreateTestInputWithExpectedResult(&plain, 1e5)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "100k.txt", bytes.NewReader(plain.Bytes())))
+
+	gz := bytes.Buffer{}
+	gw := gzip.NewWriter(&gz)
+	_, err = gw.Write(plain.Bytes())
+	testutil.Ok(t, err)
+	testutil.Ok(t, gw.Close())
+	testutil.Ok(t, bkt.Upload(ctx, "100k.txt.gz", bytes.NewReader(gz.Bytes())))
+
+	// Checksum is computed from the object as stored.
+	expectedCheckSums := func(b []byte) map[checksumAlgorithm][]byte {
+		sha := sha256.Sum256(b)
+		return map[checksumAlgorithm][]byte{
+			checksumSHA256: sha[:],
+			checksumCRC32C: binary.BigEndian.AppendUint32(nil, crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli))),
+			checksumXXHash: binary.BigEndian.AppendUint64(nil, xxhash.Sum64(b)),
+		}
+	}
+	objects := map[string]map[checksumAlgorithm][]byte{
+		"100k.txt":    expectedCheckSums(plain.Bytes()),
+		"100k.txt.gz": expectedCheckSums(gz.Bytes()),
+	}
+
+	l := &labeler{bkt: bkt, tmpDir: t.TempDir()}
+	l.pool.New = func() any { return []byte(nil) }
+	l.bucketedPool = pbytes.New(1e3, 10e6)
+
+	for objID, checkSums := range objects {
+		for name, f := range map[string]labelFunc{
+			"labelObjectNaive": l.labelObjectNaive,
+			"labelObject1":     l.labelObject1,
+			"labelObject2":     l.labelObject2,
+			"labelObject3":     l.labelObject3,
+			"labelObject4":     l.labelObject4,
+		} {
+			t.Run(objID+"/"+name, func(t *testing.T) {
+				ret, err := f(ctx, objID)
+				testutil.Ok(t, err)
+				testutil.Equals(t, exp, ret.Sum)
+				testutil.Equals(t, defaultChecksumAlgorithm, ret.CheckSumAlgorithm)
+				testutil.Equals(t, checkSums[defaultChecksumAlgorithm], ret.CheckSum)
+
+				for alg, checkSum := range checkSums {
+					ret, err := f(withChecksumAlgorithm(ctx, alg), objID)
+					testutil.Ok(t, err)
+					testutil.Equals(t, exp, ret.Sum)
+					testutil.Equals(t, alg, ret.CheckSumAlgorithm)
+					testutil.Equals(t, checkSum, ret.CheckSum)
+				}
+			})
+		}
+	}
+}
+
+func TestParseChecksumAlgorithm(t *testing.T) {
+	for name, expected := range map[string]checksumAlgorithm{
+		"":       checksumSHA256,
+		"sha256": checksumSHA256,
+		"crc32c": checksumCRC32C,
+		"xxhash": checksumXXHash,
+	} {
+		alg, err := parseChecksumAlgorithm(name)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, alg)
+	}
+	for _, name := range []string{"md5", "SHA256", "crc32"} {
+		_, err := parseChecksumAlgorithm(name)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestLabelObjectsHandler_CheckSum(t *testing.T) {
+	var algs []checksumAlgorithm
+	labelFn := func(ctx context.Context, objID string) (label, error) {
+		algs = append(algs, checksumAlgorithmFromContext(ctx))
+		return label{ObjID: objID}, nil
+	}
+	srv := httptest.NewServer(labelObjectsHandler(labelFn, 1))
+	t.Cleanup(srv.Close)
+
+	res, err := http.PostForm(srv.URL, url.Values{"object_id": {"a"}, "checksum": {"crc32c"}})
+	testutil.Ok(t, err)
+	_ = res.Body.Close()
+	testutil.Equals(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Post(srv.URL, "application/json", strings.NewReader(`{"object_ids": ["a"], "checksum": "xxhash"}`))
+	testutil.Ok(t, err)
+	_ = res.Body.Close()
+	testutil.Equals(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.PostForm(srv.URL, url.Values{"object_id": {"a"}})
+	testutil.Ok(t, err)
+	_ = res.Body.Close()
+	testutil.Equals(t, http.StatusOK, res.StatusCode)
+	testutil.Equals(t, []checksumAlgorithm{checksumCRC32C, checksumXXHash, checksumSHA256}, algs)
+
+	res, err = http.PostForm(srv.URL, url.Values{"object_id": {"a"}, "checksum": {"md5"}})
+	testutil.Ok(t, err)
+	_ = res.Body.Close()
+	testutil.Equals(t, http.StatusBadRequest, res.StatusCode)
+}
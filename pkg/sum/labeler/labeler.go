@@ -5,14 +5,12 @@ package main
 
 import (
 	"context"
-	"crypto/sha256"
 	"io"
 	"os"
 	"sync"
 
 	"github.com/efficientgo/core/errcapture"
 	"github.com/efficientgo/examples/pkg/profile/fd"
-	"github.com/efficientgo/examples/pkg/sum"
 	"github.com/gobwas/pool/pbytes"
 	"github.com/thanos-io/objstore"
 )
@@ -50,18 +48,7 @@ func (l *labeler) labelObject1(ctx context.Context, objID string) (_ label, err
 	defer errcapture.Do(&err, rc.Close, "close stream")
 
 	buf := make([]byte, bufferSize(int(a.Size)))
-	s, err := sum.Sum6Reader(rc, buf)
-	if err != nil {
-		return label{}, err
-	}
-
-	// Get/calculate other attributes...
-
-	return label{
-		ObjID: objID,
-		Sum:   s,
-		// ...
-	}, nil
+	return labelReader(ctx, objID, rc, buf)
 }
 
 func (l *labeler) labelObjectNaive(ctx context.Context, objID string) (_ label, err error) {
@@ -70,6 +57,8 @@ func (l *labeler) labelObjectNaive(ctx context.Context, objID string) (_ label,
 		return label{}, err
 	}
 
+	defer errcapture.Do(&err, rc.Close, "close stream")
+
 	// Download file first.
 	// TODO(bwplotka): This is naive for book purposes.
 	f, err := fd.CreateTemp(l.tmpDir, "cached-*")
@@ -81,29 +70,14 @@ func (l *labeler) labelObjectNaive(ctx context.Context, objID string) (_ label,
 		_ = os.RemoveAll(f.Name())
 	}()
 
-	h := sha256.New()
-
-	// Write to both checksum hash and file.
-	if _, err := io.Copy(f, io.TeeReader(rc, h)); err != nil {
+	size, err := io.Copy(f, rc)
+	if err != nil {
 		return label{}, err
 	}
-	if err := rc.Close(); err != nil {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
 		return label{}, err
 	}
-
-	s, err := sum.Sum(f.Name())
-	if err != nil {
-		return label{}, err
-	}
-
-	// Get/calculate other attributes...
-
-	return label{
-		ObjID:    objID,
-		Sum:      s,
-		CheckSum: h.Sum(nil),
-		// ...
-	}, nil
+	return labelReader(ctx, objID, f, make([]byte, bufferSize(int(size))))
 }
 
 func (l *labeler) labelObject2(ctx context.Context, objID string) (_ label, err error) {
@@ -126,18 +100,7 @@ func (l *labeler) labelObject2(ctx context.Context, objID string) (_ label, err
 	}
 	defer func() { l.pool.Put(buf) }()
 
-	s, err := sum.Sum6Reader(rc, buf[:bufSize])
-	if err != nil {
-		return label{}, err
-	}
-
-	// Get/calculate other attributes...
-
-	return label{
-		ObjID: objID,
-		Sum:   s,
-		// ...
-	}, nil
+	return labelReader(ctx, objID, rc, buf[:bufSize])
 }
 
 func (l *labeler) labelObject3(ctx context.Context, objID string) (_ label, err error) {
@@ -160,18 +123,7 @@ func (l *labeler) labelObject3(ctx context.Context, objID string) (_ label, err
 	}
 	defer func() { l.bucketedPool.Put(buf) }()
 
-	s, err := sum.Sum6Reader(rc, buf[:bufSize])
-	if err != nil {
-		return label{}, err
-	}
-
-	// Get/calculate other attributes...
-
-	return label{
-		ObjID: objID,
-		Sum:   s,
-		// ...
-	}, nil
+	return labelReader(ctx, objID, rc, buf[:bufSize])
 }
 
 func (l *labeler) labelObject4(ctx context.Context, objID string) (_ label, err error) {
@@ -191,16 +143,5 @@ func (l *labeler) labelObject4(ctx context.Context, objID string) (_ label, err
 	if cap(l.buf) < bufSize {
 		l.buf = make([]byte, bufSize)
 	}
-	s, err := sum.Sum6Reader(rc, l.buf[:bufSize])
-	if err != nil {
-		return label{}, err
-	}
-
-	// Get/calculate other attributes...
-
-	return label{
-		ObjID: objID,
-		Sum:   s,
-		// ...
-	}, nil
+	return labelReader(ctx, objID, rc, l.buf[:bufSize])
 }
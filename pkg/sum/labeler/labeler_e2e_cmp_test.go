@@ -133,14 +133,14 @@ export default function () {
 	let passed = check(res, {
 		'is status 200': (r) => r.status === 200,
 		'response': (r) =>
-			r.body.includes('{"object_id":"object.10M.txt","sum":31108000000,"checksum":null'),
+			r.body.includes('{"object_id":"object.10M.txt","sum":31108000000,"checksum":"'),
 	});
 
 	const res2 = http.get('`+url100M+`');
 	check(res2, {
 		'is status 200': (r) => r.status === 200,
 		'response': (r) =>
-			r.body.includes('{"object_id":"object.100M.txt","sum":311080000000,"checksum":null'),
+			r.body.includes('{"object_id":"object.100M.txt","sum":311080000000,"checksum":"'),
 	});
 }
 EOF`)))
@@ -258,7 +258,7 @@ export default function () {
 	let passed = check(res, {
 		'is status 200': (r) => r.status === 200,
 		'response': (r) =>
-			r.body.includes('{"object_id":"object.10M.txt","sum":311080,"checksum":null'),
+			r.body.includes('{"object_id":"object.10M.txt","sum":311080,"checksum":"'),
 	});
 
 	sleep(0.2)
@@ -266,7 +266,7 @@ export default function () {
 	check(res2, {
 		'is status 200': (r) => r.status === 200,
 		'response': (r) =>
-			r.body.includes('{"object_id":"object.100M.txt","sum":3110800,"checksum":null'),
+			r.body.includes('{"object_id":"object.100M.txt","sum":3110800,"checksum":"'),
 	});
 	sleep(0.2)
 }
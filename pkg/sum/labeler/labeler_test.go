@@ -6,6 +6,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"runtime"
 	"sync"
 	"testing"
@@ -13,6 +14,8 @@ import (
 	"github.com/efficientgo/core/testutil"
 	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
 	"github.com/gobwas/pool/pbytes"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/thanos-io/objstore"
 )
 
@@ -172,3 +175,50 @@ func TestLabeler(t *testing.T) {
 		testutil.Equals(t, exp2, ret.Sum)
 	})
 }
+
+func TestLabeler_Compressed(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	buf := bytes.Buffer{}
+	exp, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e5)
+	testutil.Ok(t, err)
+
+	gz := bytes.Buffer{}
+	gw := gzip.NewWriter(&gz)
+	_, err = gw.Write(buf.Bytes())
+	testutil.Ok(t, err)
+	testutil.Ok(t, gw.Close())
+	testutil.Ok(t, bkt.Upload(ctx, "100k.txt.gz", bytes.NewReader(gz.Bytes())))
+
+	zw, err := zstd.NewWriter(nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "100k.txt.zst", bytes.NewReader(zw.EncodeAll(buf.Bytes(), nil))))
+	testutil.Ok(t, zw.Close())
+
+	l := &labeler{bkt: bkt, tmpDir: t.TempDir()}
+	l.pool.New = func() any { return []byte(nil) }
+	l.bucketedPool = pbytes.New(1e3, 10e6)
+
+	for _, objID := range []string{"100k.txt.gz", "100k.txt.zst"} {
+		for name, f := range map[string]labelFunc{
+			"labelObjectNaive": l.labelObjectNaive,
+			"labelObject1":     l.labelObject1,
+			"labelObject2":     l.labelObject2,
+			"labelObject3":     l.labelObject3,
+			"labelObject4":     l.labelObject4,
+		} {
+			t.Run(objID+"/"+name, func(t *testing.T) {
+				ret, err := f(ctx, objID)
+				testutil.Ok(t, err)
+				testutil.Equals(t, exp, ret.Sum)
+			})
+		}
+	}
+
+	// Checksum is computed from the object as stored.
+	ret, err := l.labelObjectNaive(ctx, "100k.txt.gz")
+	testutil.Ok(t, err)
+	h := sha256.Sum256(gz.Bytes())
+	testutil.Equals(t, h[:], ret.CheckSum)
+}
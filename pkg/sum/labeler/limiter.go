@@ -0,0 +1,156 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+)
+
+// overloadedError is returned when labeling request can't be served, because all workers are busy for too long or
+// too many requests are waiting already. Clients should retry after RetryAfter.
+type overloadedError struct {
+	reason     string
+	RetryAfter time.Duration
+}
+
+func (e *overloadedError) Error() string {
+	return "labeler overloaded: " + e.reason
+}
+
+// retryAfterSeconds returns RetryAfter in whole seconds, rounded up (at least 1), so client does not retry too early.
+func (e *overloadedError) retryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// labelLimiter bounds the number of concurrent labelObject4 calls. Each worker is a labeler owning its buffer, which
+// is reused by all requests it serves. Requests wait for a free worker in a bounded queue, up to the queue timeout.
+// It is safe for concurrent use.
+type labelLimiter struct {
+	// free holds idle workers. Receivers waiting on a channel are served in FIFO order, so is the queue.
+	free         chan *labeler
+	maxQueue     int64
+	queueTimeout time.Duration
+	waiting      atomic.Int64
+
+	queueDepth prometheus.Gauge
+	waitTime   prometheus.Histogram
+	rejected   *prometheus.CounterVec
+}
+
+// newLabelLimiter returns limiter with the given number of workers labeling objects from bkt. Up to maxQueue requests
+// wait for a worker, each at most queueTimeout. Metrics are registered on reg, if not nil.
+func newLabelLimiter(reg prometheus.Registerer, bkt objstore.BucketReader, workers, maxQueue int, queueTimeout time.Duration) (*labelLimiter, error) {
+	if workers < 1 {
+		return nil, errors.Newf("limiter has to have at least one worker, got %v", workers)
+	}
+	if maxQueue < 0 {
+		return nil, errors.Newf("max queue can't be negative, got %v", maxQueue)
+	}
+
+	l := &labelLimiter{
+		free:         make(chan *labeler, workers),
+		maxQueue:     int64(maxQueue),
+		queueTimeout: queueTimeout,
+		queueDepth: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "labeler_limiter_queue_depth",
+			Help: "Number of labeling requests waiting for a free worker.",
+		}),
+		waitTime: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "labeler_limiter_wait_seconds",
+			Help:    "Time labeling requests waited for a free worker, including rejected ones.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		rejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "labeler_limiter_rejected_total",
+			Help: "Total number of labeling requests rejected, because the labeler was overloaded.",
+		}, []string{"reason"}),
+	}
+	promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "labeler_limiter_workers",
+		Help: "Number of labeler workers.",
+	}).Set(float64(workers))
+	l.rejected.WithLabelValues("queue_full")
+	l.rejected.WithLabelValues("timeout")
+
+	for i := 0; i < workers; i++ {
+		l.free <- &labeler{bkt: bkt}
+	}
+	return l, nil
+}
+
+// acquire returns a free worker, waiting for it in the queue, if needed. Worker has to be released after use.
+func (l *labelLimiter) acquire(ctx context.Context) (*labeler, error) {
+	// Fast path, no need to queue.
+	select {
+	case w := <-l.free:
+		l.waitTime.Observe(0)
+		return w, nil
+	default:
+	}
+
+	if l.waiting.Add(1) > l.maxQueue {
+		l.waiting.Add(-1)
+		l.rejected.WithLabelValues("queue_full").Inc()
+		return nil, &overloadedError{reason: "too many requests waiting for a worker", RetryAfter: l.queueTimeout}
+	}
+	l.queueDepth.Inc()
+	defer func() {
+		l.waiting.Add(-1)
+		l.queueDepth.Dec()
+	}()
+
+	start := time.Now()
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case w := <-l.free:
+		l.waitTime.Observe(time.Since(start).Seconds())
+		return w, nil
+	case <-timer.C:
+		l.waitTime.Observe(time.Since(start).Seconds())
+		l.rejected.WithLabelValues("timeout").Inc()
+		return nil, &overloadedError{reason: "timed out waiting for a worker", RetryAfter: l.queueTimeout}
+	case <-ctx.Done():
+		l.waitTime.Observe(time.Since(start).Seconds())
+		return nil, ctx.Err()
+	}
+}
+
+func (l *labelLimiter) release(w *labeler) {
+	l.free <- w
+}
+
+// labelObject4 labels object with labelObject4 of a free worker.
+func (l *labelLimiter) labelObject4(ctx context.Context, objID string) (label, error) {
+	w, err := l.acquire(ctx)
+	if err != nil {
+		return label{}, err
+	}
+	defer l.release(w)
+
+	return w.labelObject4(ctx, objID)
+}
+
+// httpLabelErrHandle is like httpErrHandle, but it responds with 429 Too Many Requests and Retry-After header,
+// if labeler is overloaded.
+func httpLabelErrHandle(w http.ResponseWriter, err error) {
+	var oerr *overloadedError
+	if !errors.As(err, &oerr) {
+		httpErrHandle(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(oerr.retryAfterSeconds()))
+	httpErrHandle(w, http.StatusTooManyRequests, err)
+}
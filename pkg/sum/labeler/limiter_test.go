@@ -0,0 +1,161 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/objstore"
+)
+
+func TestLabelLimiter(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "a.txt", strings.NewReader("1\n2\n3\n")))
+
+	t.Run("labels with reused worker buffers", func(t *testing.T) {
+		l, err := newLabelLimiter(nil, bkt, 2, 0, time.Second)
+		testutil.Ok(t, err)
+
+		wg := sync.WaitGroup{}
+		errCh := make(chan error, 20)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 10; j++ {
+					lbl, err := l.labelObject4(ctx, "a.txt")
+					if err != nil {
+						errCh <- err
+						return
+					}
+					if lbl.Sum != 6 {
+						errCh <- errors.Newf("expected sum 6, got %v", lbl.Sum)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errCh)
+		for err := range errCh {
+			testutil.Ok(t, err)
+		}
+
+		testutil.Equals(t, 2, len(l.free))
+	})
+	t.Run("worker reuses its buffer", func(t *testing.T) {
+		l, err := newLabelLimiter(nil, bkt, 1, 0, time.Second)
+		testutil.Ok(t, err)
+
+		_, err = l.labelObject4(ctx, "a.txt")
+		testutil.Ok(t, err)
+		w := <-l.free
+		buf := w.buf
+		l.release(w)
+
+		_, err = l.labelObject4(ctx, "a.txt")
+		testutil.Ok(t, err)
+		testutil.Assert(t, &buf[0] == &w.buf[0], "expected buffer to be reused")
+	})
+	t.Run("overload", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		l, err := newLabelLimiter(reg, bkt, 1, 1, 50*time.Millisecond)
+		testutil.Ok(t, err)
+
+		// Occupy the only worker.
+		w, err := l.acquire(ctx)
+		testutil.Ok(t, err)
+
+		// The first request waits in the queue, the second one is rejected immediately as queue is full.
+		queuedErr := make(chan error)
+		go func() {
+			_, err := l.labelObject4(ctx, "a.txt")
+			queuedErr <- err
+		}()
+		for promtestutil.ToFloat64(l.queueDepth) != 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		_, err = l.labelObject4(ctx, "a.txt")
+		var oerr *overloadedError
+		testutil.Assert(t, errors.As(err, &oerr), "expected overloaded error, got %v", err)
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.rejected.WithLabelValues("queue_full")))
+
+		// Queued request times out.
+		err = <-queuedErr
+		testutil.Assert(t, errors.As(err, &oerr), "expected overloaded error, got %v", err)
+		testutil.Equals(t, 50*time.Millisecond, oerr.RetryAfter)
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.rejected.WithLabelValues("timeout")))
+		testutil.Equals(t, 0.0, promtestutil.ToFloat64(l.queueDepth))
+
+		// Queued request gets the worker once it's released.
+		go func() {
+			_, err := l.labelObject4(ctx, "a.txt")
+			queuedErr <- err
+		}()
+		for promtestutil.ToFloat64(l.queueDepth) != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		l.release(w)
+		testutil.Ok(t, <-queuedErr)
+
+		// Worker acquired without waiting, timed out and successfully queued requests. Rejected with full queue
+		// don't wait at all.
+		mfs, err := reg.Gather()
+		testutil.Ok(t, err)
+		var waits uint64
+		for _, mf := range mfs {
+			if mf.GetName() == "labeler_limiter_wait_seconds" {
+				waits = mf.GetMetric()[0].GetHistogram().GetSampleCount()
+			}
+		}
+		testutil.Equals(t, uint64(3), waits)
+	})
+	t.Run("canceled while queued", func(t *testing.T) {
+		l, err := newLabelLimiter(nil, bkt, 1, 1, time.Minute)
+		testutil.Ok(t, err)
+		_, err = l.acquire(ctx)
+		testutil.Ok(t, err)
+
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = l.labelObject4(cctx, "a.txt")
+		testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := newLabelLimiter(nil, bkt, 0, 1, time.Second)
+		testutil.NotOk(t, err)
+		_, err = newLabelLimiter(nil, bkt, 1, -1, time.Second)
+		testutil.NotOk(t, err)
+	})
+}
+
+func TestHTTPLabelErrHandle(t *testing.T) {
+	for _, tcase := range []struct {
+		err                error
+		expectedCode       int
+		expectedRetryAfter string
+	}{
+		{err: errors.New("failed"), expectedCode: http.StatusInternalServerError},
+		{err: &overloadedError{reason: "busy", RetryAfter: 5 * time.Second}, expectedCode: http.StatusTooManyRequests, expectedRetryAfter: "5"},
+		{err: errors.Wrap(&overloadedError{reason: "busy", RetryAfter: 1500 * time.Millisecond}, "label"), expectedCode: http.StatusTooManyRequests, expectedRetryAfter: "2"},
+		{err: &overloadedError{reason: "busy"}, expectedCode: http.StatusTooManyRequests, expectedRetryAfter: "1"},
+	} {
+		rec := httptest.NewRecorder()
+		httpLabelErrHandle(rec, tcase.err)
+		testutil.Equals(t, tcase.expectedCode, rec.Code)
+		testutil.Equals(t, tcase.expectedRetryAfter, rec.Header().Get("Retry-After"))
+	}
+}
@@ -11,8 +11,8 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
-	"sync"
 	"syscall"
+	"time"
 
 	"github.com/efficientgo/core/errors"
 	"github.com/efficientgo/examples/pkg/metrics/httpmidleware"
@@ -36,10 +36,18 @@ const (
 )
 
 var (
-	labelerFlags       = flag.NewFlagSet("labeler-v1", flag.ExitOnError)
-	addr               = labelerFlags.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
-	objstoreConfigYAML = labelerFlags.String("objstore.config", "", "Configuration YAML for object storage to label objects against")
-	labelerFunction    = labelerFlags.String("function", "labelObjectNaive", "The function to use for labeling. labelObjectNaive, "+labelObject1+", "+labelObject2+", "+labelObject3+","+labelObject4)
+	labelerFlags        = flag.NewFlagSet("labeler-v1", flag.ExitOnError)
+	addr                = labelerFlags.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
+	objstoreConfigYAML  = labelerFlags.String("objstore.config", "", "Configuration YAML for object storage to label objects against")
+	labelerFunction     = labelerFlags.String("function", "labelObjectNaive", "The function to use for labeling. labelObjectNaive, "+labelObject1+", "+labelObject2+", "+labelObject3+","+labelObject4)
+	batchParallelism    = labelerFlags.Int("batch.parallelism", 4, "The maximum number of objects labeled concurrently for a single /label_objects request.")
+	limiterWorkers      = labelerFlags.Int("limiter.workers", 4, "The number of workers, each with its own buffer, labeling objects concurrently. Used by "+labelObject4+".")
+	limiterMaxQueue     = labelerFlags.Int("limiter.max-queue", 16, "The maximum number of requests waiting for a free worker. Requests over it get 429 Too Many Requests. Used by "+labelObject4+".")
+	limiterQueueTimeout = labelerFlags.Duration("limiter.queue-timeout", 5*time.Second, "The maximum time a request waits for a free worker before getting 429 Too Many Requests. Used by "+labelObject4+".")
+	watchInterval       = labelerFlags.Duration("watch.interval", 0, "If not 0, the labeler labels new or changed objects in the bucket every interval in the background and uploads their labels as <object>"+labelSidecarSuffix+" objects.")
+	watchDir            = labelerFlags.String("watch.dir", "", "The bucket directory watched recursively, if -watch.interval is set. Empty means the whole bucket.")
+	cacheMaxEntries     = labelerFlags.Int("cache.max-entries", 0, "The maximum number of cached labels. Labels are cached by object ID, size and last modified time. 0 disables the cache.")
+	cacheDir            = labelerFlags.String("cache.dir", "", "If not empty, cached labels are persisted in this directory too, so they survive restarts. Requires -cache.max-entries, which bounds the number of files too.")
 )
 
 func main() {
@@ -92,43 +100,27 @@ func runMain(ctx context.Context, args []string) (err error) {
 		l.bucketedPool = pbytes.New(1e3, 10e6)
 		labelObjectFunc = l.labelObject3
 	case labelObject4:
-		// Yolo.
-		labelerSet := [4]*labeler{
-			{bkt: bkt},
-			{bkt: bkt},
-			{bkt: bkt},
-			{bkt: bkt},
-		}
-		var used [4]bool
-		l := sync.Mutex{}
-
-		labelObjectFunc = func(ctx context.Context, objID string) (label, error) {
-			l.Lock()
-			found := -1
-			for i, u := range used {
-				if u {
-					continue
-				}
-				found = i
-			}
-			if found == -1 {
-				l.Unlock()
-				return label{}, errors.New("Did not expect more requests than 4 at the same time.")
-			}
-			used[found] = true
-			l.Unlock()
-
-			ret, err := labelerSet[found].labelObject4(ctx, objID)
-			l.Lock()
-			used[found] = false
-			l.Unlock()
-			return ret, err
+		limiter, err := newLabelLimiter(reg, bkt, *limiterWorkers, *limiterMaxQueue, *limiterQueueTimeout)
+		if err != nil {
+			return errors.Wrap(err, "limiter create")
 		}
+		labelObjectFunc = limiter.labelObject4
 	default:
 		return errors.Newf("unknown function %v", *labelerFunction)
 
 	}
 
+	labelObjectFunc = withLabelMetadata(*labelerFunction, labelObjectFunc)
+	if *cacheMaxEntries > 0 {
+		c, err := newLabelCache(logger, reg, bkt, *cacheMaxEntries, *cacheDir)
+		if err != nil {
+			return errors.Wrap(err, "label cache create")
+		}
+		labelObjectFunc = c.wrap(labelObjectFunc)
+	} else if *cacheDir != "" {
+		return errors.New("-cache.dir requires -cache.max-entries")
+	}
+
 	metricMiddleware := httpmidleware.NewMiddleware(reg, nil)
 	m := http.NewServeMux()
 	m.Handle("/metrics", metricMiddleware.WrapHandler("/metric", promhttp.HandlerFor(
@@ -155,15 +147,26 @@ func runMain(ctx context.Context, args []string) (err error) {
 			return
 		}
 
+		alg, err := parseChecksumAlgorithm(r.Form.Get("checksum"))
+		if err != nil {
+			httpErrHandle(w, http.StatusBadRequest, err)
+			return
+		}
+		version, err := parseLabelSchemaVersion(r.Form.Get("schema_version"))
+		if err != nil {
+			httpErrHandle(w, http.StatusBadRequest, err)
+			return
+		}
+
 		// TODO(bwplotka): Discard request body.
 
-		lbl, err := labelObjectFunc(ctx, objectIDs[0])
+		lbl, err := labelObjectFunc(withLabelSchemaVersion(withChecksumAlgorithm(ctx, alg), version), objectIDs[0])
 		if err != nil {
-			httpErrHandle(w, http.StatusInternalServerError, err)
+			httpLabelErrHandle(w, err)
 			return
 		}
 
-		b, err := json.Marshal(&lbl)
+		b, err := json.Marshal(lbl.versioned(version))
 		if err != nil {
 			httpErrHandle(w, http.StatusInternalServerError, err)
 			return
@@ -175,6 +178,8 @@ func runMain(ctx context.Context, args []string) (err error) {
 		}
 	})))
 
+	m.HandleFunc("/label_objects", metricMiddleware.WrapHandler("/label_objects", labelObjectsHandler(labelObjectFunc, *batchParallelism)))
+
 	m.HandleFunc("/debug/pprof/", pprof.Index)
 	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	m.HandleFunc("/debug/fgprof/profile", fgprof.Handler().ServeHTTP)
@@ -193,6 +198,16 @@ func runMain(ctx context.Context, args []string) (err error) {
 			level.Error(logger).Log("msg", "failed to stop web server", "err", err)
 		}
 	})
+	if *watchInterval > 0 {
+		w := newWatcher(logger, reg, bkt, *watchDir, labelObjectFunc)
+		wctx, cancel := context.WithCancel(ctx)
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "starting bucket watcher", "interval", *watchInterval, "dir", *watchDir)
+			return w.run(wctx, *watchInterval)
+		}, func(error) {
+			cancel()
+		})
+	}
 	g.Add(run.SignalHandler(ctx, syscall.SIGINT, syscall.SIGTERM))
 	return g.Run()
 }
@@ -202,8 +217,21 @@ func httpErrHandle(w http.ResponseWriter, code int, err error) {
 	_, _ = w.Write([]byte("{ \"error\": \" " + err.Error() + "\"}"))
 }
 
+// label is the result of labeling. Clients get it in the JSON schema of requested version, see label.versioned.
 type label struct {
-	ObjID    string `json:"object_id"`
-	Sum      int64  `json:"sum"`
-	CheckSum []byte `json:"checksum"`
+	ObjID             string            `json:"object_id"`
+	Sum               int64             `json:"sum"`
+	CheckSum          []byte            `json:"checksum"`
+	CheckSumAlgorithm checksumAlgorithm `json:"checksum_algorithm"`
+	SizeBytes         int64             `json:"size_bytes"`
+
+	// Fields below are computed only for labelSchemaV2.
+	Lines        int64 `json:"lines"`
+	Min          int64 `json:"min"`
+	Max          int64 `json:"max"`
+	InvalidLines int64 `json:"invalid_lines"`
+
+	// Duration and Function are filled by withLabelMetadata.
+	Duration time.Duration `json:"duration"`
+	Function string        `json:"function"`
 }
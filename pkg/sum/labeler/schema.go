@@ -0,0 +1,183 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/examples/pkg/sum"
+)
+
+// labelSchemaVersion is the version of the label JSON returned to clients.
+type labelSchemaVersion string
+
+const (
+	// labelSchemaV1 is the original label with object ID, sum and checksum. Any invalid line fails labeling.
+	labelSchemaV1 labelSchemaVersion = "v1"
+	// labelSchemaV2 adds statistics of the object and labeling metadata. Invalid lines are skipped and counted,
+	// so sum, min and max are computed from valid lines only.
+	labelSchemaV2 labelSchemaVersion = "v2"
+
+	// defaultLabelSchemaVersion is v1, so clients not aware of versions keep getting what they expect.
+	defaultLabelSchemaVersion = labelSchemaV1
+)
+
+// parseLabelSchemaVersion returns the version by name. Empty name means the default version.
+func parseLabelSchemaVersion(name string) (labelSchemaVersion, error) {
+	switch v := labelSchemaVersion(name); v {
+	case "":
+		return defaultLabelSchemaVersion, nil
+	case labelSchemaV1, labelSchemaV2:
+		return v, nil
+	default:
+		return "", errors.Newf("unknown label schema version %q, expected %v or %v", name, labelSchemaV1, labelSchemaV2)
+	}
+}
+
+type labelSchemaVersionKey struct{}
+
+// withLabelSchemaVersion returns context making labelFunc compute label for the given schema version. Like checksum
+// algorithm, it's selected per request.
+func withLabelSchemaVersion(ctx context.Context, v labelSchemaVersion) context.Context {
+	return context.WithValue(ctx, labelSchemaVersionKey{}, v)
+}
+
+// labelSchemaVersionFromContext returns the version set by withLabelSchemaVersion or the default one.
+func labelSchemaVersionFromContext(ctx context.Context) labelSchemaVersion {
+	if v, ok := ctx.Value(labelSchemaVersionKey{}).(labelSchemaVersion); ok {
+		return v
+	}
+	return defaultLabelSchemaVersion
+}
+
+// labelV1 is the JSON of labelSchemaV1. It has to stay backward compatible.
+type labelV1 struct {
+	ObjID    string `json:"object_id"`
+	Sum      int64  `json:"sum"`
+	CheckSum []byte `json:"checksum"`
+	// CheckSumAlgorithm is empty if checksum is not computed.
+	CheckSumAlgorithm checksumAlgorithm `json:"checksum_algorithm,omitempty"`
+}
+
+// labelV2 is the JSON of labelSchemaV2.
+type labelV2 struct {
+	SchemaVersion labelSchemaVersion `json:"schema_version"`
+	labelV1
+	// Lines is the number of non-blank lines, including invalid ones.
+	Lines int64 `json:"lines"`
+	// Min and Max are 0 if there are no valid lines.
+	Min          int64 `json:"min"`
+	Max          int64 `json:"max"`
+	SizeBytes    int64 `json:"size_bytes"`
+	InvalidLines int64 `json:"invalid_lines"`
+	// DurationSeconds is how long labeling took. Cached labels report the duration of the original labeling.
+	DurationSeconds float64 `json:"duration_seconds"`
+	Function        string  `json:"function"`
+}
+
+// versioned returns the label in the JSON schema of the given version.
+func (l label) versioned(v labelSchemaVersion) any {
+	v1 := labelV1{ObjID: l.ObjID, Sum: l.Sum, CheckSum: l.CheckSum, CheckSumAlgorithm: l.CheckSumAlgorithm}
+	if v != labelSchemaV2 {
+		return v1
+	}
+	return labelV2{
+		SchemaVersion:   labelSchemaV2,
+		labelV1:         v1,
+		Lines:           l.Lines,
+		Min:             l.Min,
+		Max:             l.Max,
+		SizeBytes:       l.SizeBytes,
+		InvalidLines:    l.InvalidLines,
+		DurationSeconds: l.Duration.Seconds(),
+		Function:        l.Function,
+	}
+}
+
+// withLabelMetadata returns labelFunc which fills labeling duration and the function name into labels of labelFn.
+func withLabelMetadata(function string, labelFn labelFunc) labelFunc {
+	return func(ctx context.Context, objID string) (label, error) {
+		start := time.Now()
+		lbl, err := labelFn(ctx, objID)
+		if err != nil {
+			return label{}, err
+		}
+		lbl.Duration = time.Since(start)
+		lbl.Function = function
+		return lbl, nil
+	}
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// labelReader computes label of the object from r in a single streaming pass. Checksum and size are computed from r
+// (the object as stored) and statistics from the decompressed content, if needed. Statistics other than sum are computed only for labelSchemaV2.
+func labelReader(ctx context.Context, objID string, r io.Reader, buf []byte) (_ label, err error) {
+	alg := checksumAlgorithmFromContext(ctx)
+	h := alg.newHash()
+	size := &countingWriter{}
+
+	tee := io.TeeReader(r, io.MultiWriter(h, size))
+	dr, _, err := sum.Decompress(tee)
+	if err != nil {
+		return label{}, err
+	}
+	lbl, err := func() (_ label, err error) {
+		defer errcapture.Do(&err, dr.Close, "close decompressor")
+		return labelDecompressed(ctx, objID, dr, buf)
+	}()
+	if err != nil {
+		return label{}, err
+	}
+
+	// Decompressor might not read the whole object (e.g. trailing padding), but checksum has to cover it.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return label{}, err
+	}
+	return withCheckSum(lbl, alg, h, size.n), nil
+}
+
+// labelDecompressed computes label (without checksum) from decompressed content.
+func labelDecompressed(ctx context.Context, objID string, r io.Reader, buf []byte) (label, error) {
+	if labelSchemaVersionFromContext(ctx) != labelSchemaV2 {
+		s, err := sum.SumReaderContext(ctx, r, buf, nil)
+		if err != nil {
+			return label{}, err
+		}
+		return label{ObjID: objID, Sum: s}, nil
+	}
+
+	st, err := sum.SumStatsReaderContext(ctx, r, buf, nil, true)
+	if err != nil {
+		return label{}, err
+	}
+	return label{
+		ObjID:        objID,
+		Sum:          st.Sum,
+		Lines:        st.Count + st.Invalid,
+		Min:          st.Min,
+		Max:          st.Max,
+		InvalidLines: st.Invalid,
+	}, nil
+}
+
+// withCheckSum fills checksum and size of the object as stored.
+func withCheckSum(lbl label, alg checksumAlgorithm, h hash.Hash, size int64) label {
+	lbl.CheckSum = h.Sum(nil)
+	lbl.CheckSumAlgorithm = alg
+	lbl.SizeBytes = size
+	return lbl
+}
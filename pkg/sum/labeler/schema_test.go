@@ -0,0 +1,159 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/gobwas/pool/pbytes"
+	"github.com/klauspost/compress/gzip"
+	"github.com/thanos-io/objstore"
+)
+
+func TestLabelObject_SchemaV2(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	input := []byte("100\n\n-20\n12a4\n3000\n+1\n\n7")
+	testutil.Ok(t, bkt.Upload(ctx, "input.txt", bytes.NewReader(input)))
+
+	gz := bytes.Buffer{}
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write(input)
+	testutil.Ok(t, err)
+	testutil.Ok(t, gw.Close())
+	testutil.Ok(t, bkt.Upload(ctx, "input.txt.gz", bytes.NewReader(gz.Bytes())))
+
+	l := &labeler{bkt: bkt, tmpDir: t.TempDir()}
+	l.pool.New = func() any { return []byte(nil) }
+	l.bucketedPool = pbytes.New(1e3, 10e6)
+
+	for objID, size := range map[string]int{"input.txt": len(input), "input.txt.gz": gz.Len()} {
+		for name, f := range map[string]labelFunc{
+			"labelObjectNaive": l.labelObjectNaive,
+			"labelObject1":     l.labelObject1,
+			"labelObject2":     l.labelObject2,
+			"labelObject3":     l.labelObject3,
+			"labelObject4":     l.labelObject4,
+		} {
+			t.Run(objID+"/"+name, func(t *testing.T) {
+				// Invalid lines fail v1 labeling, as they always did.
+				_, err := f(ctx, objID)
+				testutil.NotOk(t, err)
+
+				lbl, err := f(withLabelSchemaVersion(ctx, labelSchemaV2), objID)
+				testutil.Ok(t, err)
+				testutil.Equals(t, objID, lbl.ObjID)
+				testutil.Equals(t, int64(3087), lbl.Sum)
+				testutil.Equals(t, int64(6), lbl.Lines)
+				testutil.Equals(t, int64(2), lbl.InvalidLines)
+				testutil.Equals(t, int64(-20), lbl.Min)
+				testutil.Equals(t, int64(3000), lbl.Max)
+				testutil.Equals(t, int64(size), lbl.SizeBytes)
+				testutil.Equals(t, checksumSHA256, lbl.CheckSumAlgorithm)
+				testutil.Equals(t, 32, len(lbl.CheckSum))
+			})
+		}
+	}
+}
+
+func TestLabel_Versioned(t *testing.T) {
+	lbl := label{
+		ObjID:             "a.txt",
+		Sum:               10,
+		CheckSum:          []byte{1, 2},
+		CheckSumAlgorithm: checksumCRC32C,
+		SizeBytes:         12,
+		Lines:             4,
+		Min:               -1,
+		Max:               9,
+		InvalidLines:      1,
+		Duration:          1500 * time.Millisecond,
+		Function:          labelObject1,
+	}
+
+	b, err := json.Marshal(lbl.versioned(labelSchemaV1))
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"object_id":"a.txt","sum":10,"checksum":"AQI=","checksum_algorithm":"crc32c"}`, string(b))
+
+	b, err = json.Marshal(lbl.versioned(labelSchemaV2))
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"schema_version":"v2","object_id":"a.txt","sum":10,"checksum":"AQI=","checksum_algorithm":"crc32c",`+
+		`"lines":4,"min":-1,"max":9,"size_bytes":12,"invalid_lines":1,"duration_seconds":1.5,"function":"labelObject1"}`, string(b))
+
+	for name, expected := range map[string]labelSchemaVersion{"": labelSchemaV1, "v1": labelSchemaV1, "v2": labelSchemaV2} {
+		v, err := parseLabelSchemaVersion(name)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, v)
+	}
+	_, err = parseLabelSchemaVersion("v3")
+	testutil.NotOk(t, err)
+}
+
+func TestWithLabelMetadata(t *testing.T) {
+	f := withLabelMetadata("test", func(ctx context.Context, objID string) (label, error) {
+		time.Sleep(10 * time.Millisecond)
+		return label{ObjID: objID}, nil
+	})
+	lbl, err := f(context.Background(), "a")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "test", lbl.Function)
+	testutil.Assert(t, lbl.Duration >= 10*time.Millisecond, "duration %v", lbl.Duration)
+}
+
+func TestLabelObjectsHandler_SchemaVersion(t *testing.T) {
+	labelFn := withLabelMetadata("test", func(ctx context.Context, objID string) (label, error) {
+		if objID == "fail" {
+			return label{}, context.Canceled
+		}
+		return label{ObjID: objID, Lines: 3}, nil
+	})
+	srv := httptest.NewServer(labelObjectsHandler(labelFn, 1))
+	t.Cleanup(srv.Close)
+
+	res, err := http.PostForm(srv.URL, url.Values{"object_id": {"a", "fail"}, "schema_version": {"v2"}})
+	testutil.Ok(t, err)
+	defer func() { _ = res.Body.Close() }()
+
+	var results []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(readBody(t, res)), "\n") {
+		var r map[string]any
+		testutil.Ok(t, json.Unmarshal([]byte(line), &r))
+		results = append(results, r)
+	}
+	testutil.Equals(t, 2, len(results))
+	for _, r := range results {
+		if r["object_id"] == "fail" {
+			testutil.Equals(t, "context canceled", r["error"])
+			continue
+		}
+		testutil.Equals(t, "v2", r["schema_version"])
+		testutil.Equals(t, 3.0, r["lines"])
+		testutil.Equals(t, "test", r["function"])
+	}
+
+	res, err = http.PostForm(srv.URL, url.Values{"object_id": {"a"}, "schema_version": {"v3"}})
+	testutil.Ok(t, err)
+	_ = res.Body.Close()
+	testutil.Equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	testutil.Equals(t, http.StatusOK, res.StatusCode)
+	b := bytes.Buffer{}
+	_, err := b.ReadFrom(res.Body)
+	testutil.Ok(t, err)
+	return b.String()
+}
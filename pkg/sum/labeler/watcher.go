@@ -0,0 +1,234 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+)
+
+// labelSidecarSuffix is the suffix of the sidecar object with the label, next to the labeled object.
+const labelSidecarSuffix = ".label.json"
+
+// labelSidecar is the content of the sidecar object. It records which version of the object was labeled, so changed
+// objects are labeled again.
+type labelSidecar struct {
+	Object objstore.ObjectAttributes `json:"object"`
+	Label  labelV2                   `json:"label"`
+}
+
+// sameVersion returns true if attributes are of the same version of the object.
+func sameVersion(a, b objstore.ObjectAttributes) bool {
+	return a.Size == b.Size && a.LastModified.Equal(b.LastModified)
+}
+
+// watcher periodically labels new or changed objects in the bucket and uploads their labels as sidecar objects
+// (<object>.label.json, in labelSchemaV2). All its state is in the bucket, so restarted watcher resumes where it
+// stopped, without labeling objects again. Sidecars of deleted objects are deleted too.
+//
+// Changes are detected by object size and modification time only (see sameVersion), so:
+//   - every iteration gets attributes of every object, one request per object, even if nothing changed,
+//   - an object rewritten with the same size within the modification time granularity of the provider (e.g. of the
+//     filesystem one) is not labeled again. Comparing checksums would require reading all objects in every iteration.
+type watcher struct {
+	bkt     objstore.Bucket
+	dir     string
+	labelFn labelFunc
+	logger  log.Logger
+
+	// labeled are the labeled versions of objects, so unchanged objects are skipped without reading their sidecars.
+	labeled map[string]objstore.ObjectAttributes
+
+	iterations      prometheus.Counter
+	labeledObjects  prometheus.Counter
+	failedObjects   prometheus.Counter
+	deletedSidecars prometheus.Counter
+}
+
+// newWatcher returns watcher labeling objects in the dir (recursively, empty means the whole bucket) with labelFn.
+// Metrics are registered on reg, if not nil.
+func newWatcher(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, dir string, labelFn labelFunc) *watcher {
+	return &watcher{
+		bkt:     bkt,
+		dir:     dir,
+		labelFn: labelFn,
+		logger:  logger,
+		labeled: map[string]objstore.ObjectAttributes{},
+		iterations: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "labeler_watcher_iterations_total",
+			Help: "Total number of bucket iterations done by the watcher.",
+		}),
+		labeledObjects: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "labeler_watcher_labeled_objects_total",
+			Help: "Total number of new or changed objects labeled by the watcher.",
+		}),
+		failedObjects: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "labeler_watcher_failed_objects_total",
+			Help: "Total number of objects the watcher failed to label. They are retried in the next iteration.",
+		}),
+		deletedSidecars: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "labeler_watcher_deleted_sidecars_total",
+			Help: "Total number of sidecars of deleted objects removed by the watcher.",
+		}),
+	}
+}
+
+// run labels objects every interval, until ctx is canceled.
+func (w *watcher) run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := w.iterate(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			level.Error(w.logger).Log("msg", "bucket iteration failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// iterate labels all new or changed objects and deletes sidecars of deleted objects once. Failure of a single object
+// does not stop the iteration, it's logged and retried in the next one.
+func (w *watcher) iterate(ctx context.Context) error {
+	w.iterations.Inc()
+
+	var names, sidecars []string
+	if err := w.bkt.Iter(ctx, w.dir, func(name string) error {
+		switch {
+		case strings.HasSuffix(name, objstore.DirDelim):
+		case strings.HasSuffix(name, labelSidecarSuffix):
+			sidecars = append(sidecars, name)
+		default:
+			names = append(names, name)
+		}
+		return nil
+	}, objstore.WithRecursiveIter); err != nil {
+		return errors.Wrap(err, "iter")
+	}
+	if err := w.deleteOrphanedSidecars(ctx, names, sidecars); err != nil {
+		return err
+	}
+
+	labeled := make(map[string]objstore.ObjectAttributes, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		a, err := w.bkt.Attributes(ctx, name)
+		if err != nil {
+			if w.bkt.IsObjNotFoundErr(err) {
+				// Deleted in the meantime.
+				continue
+			}
+			w.failedObjects.Inc()
+			level.Warn(w.logger).Log("msg", "failed to get object attributes", "object", name, "err", err)
+			continue
+		}
+
+		if err := w.labelIfChanged(ctx, name, a); err != nil {
+			w.failedObjects.Inc()
+			level.Warn(w.logger).Log("msg", "failed to label object", "object", name, "err", err)
+			continue
+		}
+		labeled[name] = a
+	}
+	// Forget deleted objects.
+	w.labeled = labeled
+	return nil
+}
+
+// deleteOrphanedSidecars deletes sidecars of objects which are not listed in names.
+func (w *watcher) deleteOrphanedSidecars(ctx context.Context, names, sidecars []string) error {
+	objects := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		objects[name] = struct{}{}
+	}
+	for _, sidecar := range sidecars {
+		if _, ok := objects[strings.TrimSuffix(sidecar, labelSidecarSuffix)]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.bkt.Delete(ctx, sidecar); err != nil && !w.bkt.IsObjNotFoundErr(err) {
+			level.Warn(w.logger).Log("msg", "failed to delete sidecar of deleted object", "sidecar", sidecar, "err", err)
+			continue
+		}
+		w.deletedSidecars.Inc()
+	}
+	return nil
+}
+
+// labelIfChanged labels the object and uploads its sidecar, unless the sidecar for this version exists already.
+func (w *watcher) labelIfChanged(ctx context.Context, name string, a objstore.ObjectAttributes) error {
+	if prev, ok := w.labeled[name]; ok && sameVersion(prev, a) {
+		return nil
+	}
+
+	sidecar, ok, err := w.sidecar(ctx, name)
+	if err != nil {
+		return err
+	}
+	if ok && sameVersion(sidecar.Object, a) {
+		return nil
+	}
+
+	lbl, err := w.labelFn(withLabelSchemaVersion(ctx, labelSchemaV2), name)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(labelSidecar{Object: a, Label: lbl.versioned(labelSchemaV2).(labelV2)})
+	if err != nil {
+		return err
+	}
+	if err := w.bkt.Upload(ctx, name+labelSidecarSuffix, bytes.NewReader(b)); err != nil {
+		return errors.Wrap(err, "upload sidecar")
+	}
+	w.labeledObjects.Inc()
+	return nil
+}
+
+// sidecar returns the sidecar of the object, if it exists.
+func (w *watcher) sidecar(ctx context.Context, name string) (_ labelSidecar, _ bool, err error) {
+	rc, err := w.bkt.Get(ctx, name+labelSidecarSuffix)
+	if err != nil {
+		if w.bkt.IsObjNotFoundErr(err) {
+			return labelSidecar{}, false, nil
+		}
+		return labelSidecar{}, false, errors.Wrap(err, "get sidecar")
+	}
+	defer errcapture.Do(&err, rc.Close, "close sidecar")
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return labelSidecar{}, false, errors.Wrap(err, "read sidecar")
+	}
+	var s labelSidecar
+	if err := json.Unmarshal(b, &s); err != nil {
+		// Corrupted (e.g. partially written by other tool) sidecar is just overwritten.
+		level.Warn(w.logger).Log("msg", "ignoring invalid sidecar", "object", name, "err", err)
+		return labelSidecar{}, false, nil
+	}
+	return s, true, nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func readSidecar(t *testing.T, bkt objstore.BucketReader, name string) labelSidecar {
+	t.Helper()
+
+	rc, err := bkt.Get(context.Background(), name+labelSidecarSuffix)
+	testutil.Ok(t, err)
+	defer func() { _ = rc.Close() }()
+
+	b, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	var s labelSidecar
+	testutil.Ok(t, json.Unmarshal(b, &s))
+	return s
+}
+
+func listObjects(t *testing.T, bkt objstore.BucketReader) []string {
+	t.Helper()
+
+	var names []string
+	testutil.Ok(t, bkt.Iter(context.Background(), "", func(name string) error {
+		names = append(names, name)
+		return nil
+	}, objstore.WithRecursiveIter))
+	sort.Strings(names)
+	return names
+}
+
+func TestWatcher(t *testing.T) {
+	fsBkt, err := filesystem.NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	for name, bkt := range map[string]objstore.Bucket{
+		"inmem":      objstore.NewInMemBucket(),
+		"filesystem": fsBkt,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			testutil.Ok(t, bkt.Upload(ctx, "a.txt", strings.NewReader("1\n2\n3\n")))
+			testutil.Ok(t, bkt.Upload(ctx, "dir/b.txt", strings.NewReader("10\n20\n")))
+			testutil.Ok(t, bkt.Upload(ctx, "dir/sub/c.txt", strings.NewReader("100\n12a4\n")))
+
+			var calls atomic.Int64
+			l := &labeler{bkt: bkt}
+			labelFn := withLabelMetadata(labelObject1, func(ctx context.Context, objID string) (label, error) {
+				calls.Add(1)
+				return l.labelObject1(ctx, objID)
+			})
+
+			w := newWatcher(log.NewNopLogger(), nil, bkt, "", labelFn)
+			testutil.Ok(t, w.iterate(ctx))
+			testutil.Equals(t, int64(3), calls.Load())
+			testutil.Equals(t, 3.0, promtestutil.ToFloat64(w.labeledObjects))
+			testutil.Equals(t, []string{
+				"a.txt", "a.txt" + labelSidecarSuffix,
+				"dir/b.txt", "dir/b.txt" + labelSidecarSuffix,
+				"dir/sub/c.txt", "dir/sub/c.txt" + labelSidecarSuffix,
+			}, listObjects(t, bkt))
+
+			s := readSidecar(t, bkt, "a.txt")
+			testutil.Equals(t, int64(6), s.Object.Size)
+			testutil.Equals(t, labelSchemaV2, s.Label.SchemaVersion)
+			testutil.Equals(t, "a.txt", s.Label.ObjID)
+			testutil.Equals(t, int64(6), s.Label.Sum)
+			testutil.Equals(t, int64(3), s.Label.Lines)
+			testutil.Equals(t, labelObject1, s.Label.Function)
+
+			s = readSidecar(t, bkt, "dir/sub/c.txt")
+			testutil.Equals(t, int64(100), s.Label.Sum)
+			testutil.Equals(t, int64(1), s.Label.InvalidLines)
+
+			// Unchanged objects are not labeled again.
+			testutil.Ok(t, w.iterate(ctx))
+			testutil.Equals(t, int64(3), calls.Load())
+
+			// Restarted watcher resumes from sidecars.
+			reg := prometheus.NewRegistry()
+			w = newWatcher(log.NewNopLogger(), reg, bkt, "", labelFn)
+			testutil.Ok(t, w.iterate(ctx))
+			testutil.Equals(t, int64(3), calls.Load())
+			testutil.Equals(t, 0.0, promtestutil.ToFloat64(w.labeledObjects))
+
+			// New and changed objects are labeled.
+			testutil.Ok(t, bkt.Upload(ctx, "dir/b.txt", strings.NewReader("10\n20\n30\n")))
+			testutil.Ok(t, bkt.Upload(ctx, "d.txt", strings.NewReader("-1\n")))
+			testutil.Ok(t, w.iterate(ctx))
+			testutil.Equals(t, int64(5), calls.Load())
+			testutil.Equals(t, 2.0, promtestutil.ToFloat64(w.labeledObjects))
+			testutil.Equals(t, int64(60), readSidecar(t, bkt, "dir/b.txt").Label.Sum)
+			testutil.Equals(t, int64(-1), readSidecar(t, bkt, "d.txt").Label.Sum)
+
+			// Only the watched directory is labeled.
+			testutil.Ok(t, bkt.Upload(ctx, "e.txt", strings.NewReader("5\n")))
+			testutil.Ok(t, bkt.Upload(ctx, "dir/sub/f.txt", strings.NewReader("7\n")))
+			testutil.Ok(t, newWatcher(log.NewNopLogger(), nil, bkt, "dir/", labelFn).iterate(ctx))
+			testutil.Equals(t, int64(6), calls.Load())
+			testutil.Equals(t, int64(7), readSidecar(t, bkt, "dir/sub/f.txt").Label.Sum)
+			exists, err := bkt.Exists(ctx, "e.txt"+labelSidecarSuffix)
+			testutil.Ok(t, err)
+			testutil.Assert(t, !exists)
+
+			// Sidecars of deleted objects are deleted.
+			testutil.Ok(t, bkt.Delete(ctx, "a.txt"))
+			testutil.Ok(t, bkt.Delete(ctx, "dir/sub/c.txt"))
+			testutil.Ok(t, w.iterate(ctx))
+			testutil.Equals(t, 2.0, promtestutil.ToFloat64(w.deletedSidecars))
+			testutil.Equals(t, []string{
+				"d.txt", "d.txt" + labelSidecarSuffix,
+				"dir/b.txt", "dir/b.txt" + labelSidecarSuffix,
+				"dir/sub/f.txt", "dir/sub/f.txt" + labelSidecarSuffix,
+				"e.txt", "e.txt" + labelSidecarSuffix,
+			}, listObjects(t, bkt))
+		})
+	}
+}
+
+func TestWatcher_Failures(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "a.txt", strings.NewReader("1\n")))
+	testutil.Ok(t, bkt.Upload(ctx, "b.txt", strings.NewReader("2\n")))
+	// Corrupted sidecar is overwritten.
+	testutil.Ok(t, bkt.Upload(ctx, "b.txt"+labelSidecarSuffix, strings.NewReader("{")))
+
+	var fail atomic.Bool
+	fail.Store(true)
+	l := &labeler{bkt: bkt}
+	labelFn := func(ctx context.Context, objID string) (label, error) {
+		if objID == "a.txt" && fail.Load() {
+			return label{}, errors.New("failed")
+		}
+		return l.labelObject1(ctx, objID)
+	}
+
+	w := newWatcher(log.NewNopLogger(), nil, bkt, "", labelFn)
+	testutil.Ok(t, w.iterate(ctx))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(w.failedObjects))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(w.labeledObjects))
+	testutil.Equals(t, int64(2), readSidecar(t, bkt, "b.txt").Label.Sum)
+	exists, err := bkt.Exists(ctx, "a.txt"+labelSidecarSuffix)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists)
+
+	// Failed object is retried in the next iteration.
+	fail.Store(false)
+	testutil.Ok(t, w.iterate(ctx))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(w.labeledObjects))
+	testutil.Equals(t, int64(1), readSidecar(t, bkt, "a.txt").Label.Sum)
+}
+
+func TestWatcher_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "a.txt", strings.NewReader("1\n")))
+
+	l := &labeler{bkt: bkt}
+	w := newWatcher(log.NewNopLogger(), nil, bkt, "", l.labelObject1)
+
+	done := make(chan error)
+	go func() { done <- w.run(ctx, 10*time.Millisecond) }()
+
+	for promtestutil.ToFloat64(w.iterations) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(w.labeledObjects))
+
+	cancel()
+	testutil.Ok(t, <-done)
+}
@@ -1,11 +1,21 @@
 // Copyright (c) Efficient Go Authors
 // Licensed under the Apache License 2.0.
 
+// Package sum contains implementations of summing integers from files, from the naive one to the optimized ones,
+// as explained in "Efficient Go".
+//
+// Most functions accumulate into int64 and silently wrap around if a number or the sum does not fit in int64.
+// Only SumChecked, SumReaderChecked, ConcurrentSumChecked and the Decimal functions detect overflows (see ErrOverflow).
+// Sum to Sum7, the SWAR, mmap, Format, Stats, binary and compressed variants, SumPool, Cache and SumAuto's Plan.Sum
+// have no checked counterpart on purpose: they show step by step optimizations of the unchecked fast path, and the
+// checks would change what their benchmarks measure (see BenchmarkSumChecked for the cost of the checks). Use the
+// checked functions if the input is not trusted to fit in int64.
 package sum
 
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"strconv"
@@ -23,12 +33,16 @@ func Sum(fileName string) (ret int64, _ error) {
 		return 0, err
 	}
 	for _, line := range bytes.Split(b, []byte("\n")) {
-		if len(line) == 0 {
-			// Empty line at the end.
+		// Empty line at the end is skipped too.
+		tok, ok, err := DefaultFormat.Token(line)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
 			continue
 		}
 
-		num, err := strconv.ParseInt(string(line), 10, 64)
+		num, err := strconv.ParseInt(string(tok), 10, 64)
 		if err != nil {
 			return 0, err
 		}
@@ -49,12 +63,21 @@ func Sum2(fileName string) (ret int64, _ error) {
 		return 0, err
 	}
 
+	b = terminated(b)
 	var last int
 	for i := 0; i < len(b); i++ {
 		if b[i] != '\n' {
 			continue
 		}
-		num, err := strconv.ParseInt(string(b[last:i]), 10, 64)
+		tok, ok, err := DefaultFormat.Token(b[last:i])
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			last = i + 1
+			continue
+		}
+		num, err := strconv.ParseInt(string(tok), 10, 64)
 		if err != nil {
 			return 0, err
 		}
@@ -74,15 +97,23 @@ func Sum2_scanner(fileName string) (ret int64, err error) {
 	defer errcapture.Do(&err, f.Close, "close file")
 
 	scanner := bufio.NewScanner(f)
+	scanner.Split(ScanLines)
 	for scanner.Scan() {
-		num, err := strconv.ParseInt(string(scanner.Bytes()), 10, 64)
+		tok, ok, err := DefaultFormat.Token(scanner.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		num, err := strconv.ParseInt(string(tok), 10, 64)
 		if err != nil {
 			return 0, err
 		}
 
 		ret += num
 	}
-	return ret, nil
+	return ret, scanner.Err()
 }
 
 func zeroCopyToString(b []byte) string {
@@ -100,12 +131,21 @@ func Sum3(fileName string) (ret int64, _ error) {
 		return 0, err
 	}
 
+	b = terminated(b)
 	var last int
 	for i := 0; i < len(b); i++ {
 		if b[i] != '\n' {
 			continue
 		}
-		num, err := strconv.ParseInt(zeroCopyToString(b[last:i]), 10, 64)
+		tok, ok, err := DefaultFormat.Token(b[last:i])
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			last = i + 1
+			continue
+		}
+		num, err := strconv.ParseInt(zeroCopyToString(tok), 10, 64)
 		if err != nil {
 			return 0, err
 		}
@@ -118,11 +158,18 @@ func Sum3(fileName string) (ret int64, _ error) {
 
 // ParseInt is 3-4x times faster than strconv.ParseInt or Atoi.
 func ParseInt(input []byte) (n int64, _ error) {
+	if len(input) == 0 {
+		return 0, errors.New("not a valid integer: empty input")
+	}
+
 	factor := int64(1)
 	k := 0
 
 	// TODO(bwplotka): Optimize if only positive integers are accepted (only 2.6% overhead in my tests though).
 	if input[0] == '-' {
+		if len(input) == 1 {
+			return 0, errors.Newf("not a valid integer: %v", input)
+		}
 		factor *= -1
 		k++
 	}
@@ -138,6 +185,29 @@ func ParseInt(input []byte) (n int64, _ error) {
 	return n, nil
 }
 
+// ParseError is returned when a line of the input is not a valid integer. It points to the invalid line, so
+// corrupted input can be inspected without re-running the whole computation.
+type ParseError struct {
+	// Offset is the byte offset of the beginning of the invalid line.
+	Offset int64
+	// Line is the 1-based number of the invalid line.
+	Line int
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d (byte offset %d): %v", e.Line, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// newParseError returns ParseError for the line starting at the given offset of b.
+// Counting lines is done only on error path, so the happy path does not pay for it.
+func newParseError(b []byte, offset int, err error) *ParseError {
+	return &ParseError{Offset: int64(offset), Line: bytes.Count(b[:offset], []byte("\n")) + 1, Err: err}
+}
+
 // Sum4 is a sum with optimized the second latency + CPU bottleneck: ParseInt and string conversion.
 // On CPU profile we see that ParseInt does a lot of checks that we might not need. We write our own parsing
 // straight from byte to avoid conversion CPU time.
@@ -149,12 +219,14 @@ func Sum4(fileName string) (ret int64, err error) {
 		return 0, err
 	}
 
+	b = terminated(b)
 	var last int
 	for i := 0; i < len(b); i++ {
 		if b[i] != '\n' {
 			continue
 		}
-		num, err := ParseInt(b[last:i])
+		// Skipped lines are parsed as 0.
+		num, _, err := DefaultFormat.ParseInt(b[last:i])
 		if err != nil {
 			return 0, err
 		}
@@ -171,12 +243,21 @@ func Sum4_atoi(fileName string) (ret int64, err error) {
 		return 0, err
 	}
 
+	b = terminated(b)
 	var last int
 	for i := 0; i < len(b); i++ {
 		if b[i] != '\n' {
 			continue
 		}
-		num, err := strconv.Atoi(zeroCopyToString(b[last:i]))
+		tok, ok, err := DefaultFormat.Token(b[last:i])
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			last = i + 1
+			continue
+		}
+		num, err := strconv.Atoi(zeroCopyToString(tok))
 		if err != nil {
 			return 0, err
 		}
@@ -199,8 +280,10 @@ func Sum5(fileName string) (ret int64, err error) {
 	defer errcapture.Do(&err, f.Close, "close file")
 
 	scanner := bufio.NewScanner(f)
+	// Our ScanLines, unlike bufio.ScanLines, does not drop '\r', so it's up to the format to allow it.
+	scanner.Split(ScanLines)
 	for scanner.Scan() {
-		num, err := ParseInt(scanner.Bytes())
+		num, _, err := DefaultFormat.ParseInt(scanner.Bytes())
 		if err != nil {
 			return 0, err
 		}
@@ -220,7 +303,7 @@ func Sum5_line(fileName string) (ret int64, err error) {
 	scanner := bufio.NewScanner(f)
 	scanner.Split(ScanLines)
 	for scanner.Scan() {
-		num, err := ParseInt(scanner.Bytes())
+		num, _, err := DefaultFormat.ParseInt(scanner.Bytes())
 		if err != nil {
 			return 0, err
 		}
@@ -278,7 +361,7 @@ func Sum6Reader(r io.Reader, buf []byte) (ret int64, err error) { // Just inlini
 			if buf[i] != '\n' {
 				continue
 			}
-			num, err := ParseInt(buf[last:i])
+			num, _, err := DefaultFormat.ParseInt(buf[last:i])
 			if err != nil {
 				return 0, err
 			}
@@ -292,23 +375,24 @@ func Sum6Reader(r io.Reader, buf []byte) (ret int64, err error) { // Just inlini
 			_ = copy(buf, buf[last:n])
 		}
 	}
+
+	if offset > 0 {
+		// Final line without newline.
+		num, _, err := DefaultFormat.ParseInt(buf[:offset])
+		if err != nil {
+			return 0, err
+		}
+		ret += num
+	}
 	return ret, nil
 }
 
-var sumByFile = map[string]int64{}
+// defaultCache is used by Sum7.
+var defaultCache = NewCache(1024, Sum)
 
 // Sum7 is cached (cheating!) (:
+// Results are invalidated when the file changes, see Cache.
 // Read more in "Efficient Go"; Example 10-15.
 func Sum7(fileName string) (int64, error) {
-	if s, ok := sumByFile[fileName]; ok {
-		return s, nil
-	}
-
-	ret, err := Sum(fileName)
-	if err != nil {
-		return 0, err
-	}
-
-	sumByFile[fileName] = ret
-	return ret, nil
+	return defaultCache.Sum(fileName)
 }
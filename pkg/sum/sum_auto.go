@@ -0,0 +1,305 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/efficientgo/core/errcapture"
+)
+
+// Strategy is the way SumAuto sums the file.
+type Strategy int
+
+const (
+	// StrategyInMemory reads the whole file on heap and sums it in a single goroutine (Sum4).
+	StrategyInMemory Strategy = iota
+	// StrategyStreaming reads file with a small buffer in a single goroutine (Sum6).
+	StrategyStreaming
+	// StrategySharded reads and sums shards of the file concurrently, each with a small buffer (ConcurrentSum4).
+	StrategySharded
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case StrategyInMemory:
+		return "in-memory"
+	case StrategyStreaming:
+		return "streaming"
+	case StrategySharded:
+		return "sharded"
+	}
+	return "unknown"
+}
+
+const (
+	// minBytesPerWorker is the minimum shard size worth a goroutine. Below that, starting goroutines and
+	// aligning shards costs more than summing them.
+	minBytesPerWorker = 256 * 1024
+	// inMemoryHeadroom is the fraction of available memory the in-memory strategy can use for the file.
+	inMemoryHeadroom = 4
+)
+
+// Plan describes how SumAuto sums the file and why. It's exposed for debugging (e.g. logging).
+type Plan struct {
+	Strategy Strategy
+	// Workers is the number of goroutines summing the file.
+	Workers int
+
+	// FileSize, AvailableMemory and CPUs are the inputs of the decision.
+	FileSize int64
+	// AvailableMemory is the memory available to the process in bytes, -1 if unknown (treated as unlimited).
+	AvailableMemory int64
+	// CPUs is the effective number of CPUs: GOMAXPROCS limited by the cgroup CPU quota, if any.
+	CPUs int
+	// Compression of the file, detected from its first bytes.
+	Compression Compression
+
+	Reason string
+}
+
+func (p Plan) String() string {
+	return fmt.Sprintf("%v with %v workers (file size %v, available memory %v, CPUs %v, compression %v): %v",
+		p.Strategy, p.Workers, p.FileSize, p.AvailableMemory, p.CPUs, p.Compression, p.Reason)
+}
+
+// Sum sums the file according to the plan.
+func (p Plan) Sum(fileName string) (_ int64, err error) {
+	if p.Compression != NoCompression {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return 0, err
+		}
+		defer errcapture.Do(&err, f.Close, "close file")
+
+		return sumCompressed(f, DefaultFormat)
+	}
+
+	switch p.Strategy {
+	case StrategyInMemory:
+		return Sum4(fileName)
+	case StrategySharded:
+		return ConcurrentSum4(fileName, p.Workers)
+	}
+	return Sum6(fileName)
+}
+
+// NewPlan returns the plan SumAuto would use for the file at this moment.
+func NewPlan(fileName string) (_ Plan, err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Plan{}, err
+	}
+	defer errcapture.Do(&err, f.Close, "close file")
+
+	fi, err := f.Stat()
+	if err != nil {
+		return Plan{}, err
+	}
+	header := make([]byte, magicLen)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return Plan{}, err
+	}
+	return newPlan(
+		fi.Size(),
+		DetectCompression(header[:n]),
+		availableMemory("/proc/meminfo", "/proc/self/cgroup", "/sys/fs/cgroup"),
+		effectiveCPUs("/proc/self/cgroup", "/sys/fs/cgroup"),
+	), nil
+}
+
+// newPlan decides the strategy. It's deterministic, so it's easy to test.
+func newPlan(size int64, compression Compression, availableMemory int64, cpus int) Plan {
+	p := Plan{Workers: 1, FileSize: size, AvailableMemory: availableMemory, CPUs: cpus, Compression: compression}
+	if compression != NoCompression {
+		p.Strategy = StrategyStreaming
+		p.Reason = fmt.Sprintf("%v compressed file can't be sharded, it's decompressed in a single stream", compression)
+		return p
+	}
+
+	workers := int(size / minBytesPerWorker)
+	if workers > cpus {
+		workers = cpus
+	}
+	if workers >= 2 {
+		p.Strategy = StrategySharded
+		p.Workers = workers
+		p.Reason = fmt.Sprintf("file is big enough for %v shards of at least %v bytes", workers, minBytesPerWorker)
+		return p
+	}
+
+	reason := "file is too small to shard"
+	if cpus < 2 {
+		reason = "only one CPU available"
+	}
+	if availableMemory >= 0 && size > availableMemory/inMemoryHeadroom {
+		p.Strategy = StrategyStreaming
+		p.Reason = reason + " and it does not fit comfortably in memory"
+		return p
+	}
+	p.Strategy = StrategyInMemory
+	p.Reason = reason + " and it fits in memory"
+	return p
+}
+
+// SumAuto sums the file with the strategy and number of workers that fit the file size and resources available
+// to the process (memory and CPU, including container limits). Use NewPlan to check what it would do.
+func SumAuto(fileName string) (int64, error) {
+	p, err := NewPlan(fileName)
+	if err != nil {
+		return 0, err
+	}
+	return p.Sum(fileName)
+}
+
+// cgroupDirs returns cgroup v2 directories of this process and all its ancestors to look for limits in, the most
+// specific first. Cgroups of the process are read from procCgroupPath (/proc/self/cgroup). With cgroup namespaces
+// (typical for containers) the process cgroup is mounted at the root.
+func cgroupDirs(procCgroupPath string, root string) []string {
+	var dirs []string
+	if b, err := os.ReadFile(procCgroupPath); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			// cgroup v2 line has the form "0::/path".
+			p, ok := strings.CutPrefix(line, "0::")
+			if !ok {
+				continue
+			}
+			for p = filepath.Clean("/" + p); p != "/"; p = filepath.Dir(p) {
+				dirs = append(dirs, filepath.Join(root, p))
+			}
+		}
+	}
+	return append(dirs, root)
+}
+
+// effectiveCPUs returns GOMAXPROCS limited by the cgroup (v2 or v1) CPU quota, rounded up.
+func effectiveCPUs(procCgroupPath string, cgroupRoot string) int {
+	cpus := runtime.GOMAXPROCS(0)
+	if quota, ok := cpuQuota(cgroupDirs(procCgroupPath, cgroupRoot), cgroupRoot); ok {
+		if q := int(math.Ceil(quota)); q < cpus {
+			cpus = q
+		}
+	}
+	if cpus < 1 {
+		return 1
+	}
+	return cpus
+}
+
+// cpuQuota returns the CPU quota in number of CPUs, if there is any. For cgroup v2 it's the smallest quota of all
+// v2Dirs, as every ancestor limits its descendants.
+func cpuQuota(v2Dirs []string, cgroupRoot string) (float64, bool) {
+	minQuota, found := 0.0, false
+	for _, dir := range v2Dirs {
+		// cgroup v2: "<quota> <period>" or "max <period>" if there is no limit.
+		b, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 {
+			continue
+		}
+		if q, ok := quotaRatio(fields[0], fields[1]); ok && (!found || q < minQuota) {
+			minQuota, found = q, true
+		}
+	}
+	if found {
+		return minQuota, true
+	}
+
+	// cgroup v1: quota is -1 if there is no limit.
+	quota, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	return quotaRatio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func quotaRatio(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
+
+// availableMemory returns memory available to the process: MemAvailable from meminfo, limited by the
+// cgroup (v2 or v1) memory limit minus the current cgroup usage. It returns -1 if none is known.
+func availableMemory(meminfoPath string, procCgroupPath string, cgroupRoot string) int64 {
+	available := int64(-1)
+	if b, err := os.ReadFile(meminfoPath); err == nil {
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			// Line has the form "MemAvailable:   12345 kB".
+			fields := strings.Fields(s.Text())
+			if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+				if kb, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+					available = kb * 1024
+				}
+				break
+			}
+		}
+	}
+
+	if limit, ok := cgroupMemoryLeft(cgroupDirs(procCgroupPath, cgroupRoot), cgroupRoot); ok && (available < 0 || limit < available) {
+		available = limit
+	}
+	return available
+}
+
+// cgroupMemoryLeft returns the cgroup memory limit minus the current usage, if there is a limit. For cgroup v2 it's
+// the smallest one of all v2Dirs, as every ancestor limits its descendants.
+func cgroupMemoryLeft(v2Dirs []string, cgroupRoot string) (int64, bool) {
+	readInt := func(file string) (int64, bool) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		return v, err == nil
+	}
+
+	minLeft, found := int64(0), false
+	for _, dir := range v2Dirs {
+		// cgroup v2: "max" if there is no limit, which does not parse.
+		limit, ok := readInt(filepath.Join(dir, "memory.max"))
+		if !ok {
+			continue
+		}
+		usage, _ := readInt(filepath.Join(dir, "memory.current"))
+		if left := limit - usage; !found || left < minLeft {
+			minLeft, found = left, true
+		}
+	}
+	if found {
+		return minLeft, true
+	}
+
+	// cgroup v1: no limit is a huge number (page counter max), which we treat as unlimited.
+	limit, ok := readInt(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"))
+	if !ok || limit >= math.MaxInt64/2 {
+		return 0, false
+	}
+	usage, _ := readInt(filepath.Join(cgroupRoot, "memory", "memory.usage_in_bytes"))
+	return limit - usage, true
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+)
+
+func TestNewPlan(t *testing.T) {
+	const mb = 1024 * 1024
+
+	for _, tcase := range []struct {
+		name            string
+		size            int64
+		availableMemory int64
+		cpus            int
+		compression     Compression
+
+		expectedStrategy Strategy
+		expectedWorkers  int
+	}{
+		{name: "empty", size: 0, availableMemory: -1, cpus: 4, expectedStrategy: StrategyInMemory, expectedWorkers: 1},
+		{name: "tiny", size: 10, availableMemory: 100 * mb, cpus: 4, expectedStrategy: StrategyInMemory, expectedWorkers: 1},
+		{name: "too small for two shards", size: 2*minBytesPerWorker - 1, availableMemory: -1, cpus: 4, expectedStrategy: StrategyInMemory, expectedWorkers: 1},
+		{name: "two shards", size: 2 * minBytesPerWorker, availableMemory: -1, cpus: 4, expectedStrategy: StrategySharded, expectedWorkers: 2},
+		// Like labeler e2e container with 4 CPUs limit on a bigger machine.
+		{name: "limited by CPUs", size: 1000 * mb, availableMemory: 100 * mb, cpus: 4, expectedStrategy: StrategySharded, expectedWorkers: 4},
+		{name: "single CPU, fits in memory", size: 20 * mb, availableMemory: 100 * mb, cpus: 1, expectedStrategy: StrategyInMemory, expectedWorkers: 1},
+		{name: "single CPU, does not fit in memory", size: 30 * mb, availableMemory: 100 * mb, cpus: 1, expectedStrategy: StrategyStreaming, expectedWorkers: 1},
+		{name: "single CPU, unknown memory", size: 1000 * mb, availableMemory: -1, cpus: 1, expectedStrategy: StrategyInMemory, expectedWorkers: 1},
+		{name: "compressed, small", size: 10, availableMemory: 100 * mb, cpus: 4, compression: Gzip, expectedStrategy: StrategyStreaming, expectedWorkers: 1},
+		{name: "compressed, big", size: 1000 * mb, availableMemory: -1, cpus: 4, compression: Zstd, expectedStrategy: StrategyStreaming, expectedWorkers: 1},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			p := newPlan(tcase.size, tcase.compression, tcase.availableMemory, tcase.cpus)
+			testutil.Equals(t, tcase.expectedStrategy, p.Strategy, p.String())
+			testutil.Equals(t, tcase.expectedWorkers, p.Workers, p.String())
+		})
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		testutil.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), os.ModePerm))
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm))
+	}
+}
+
+func TestCPUQuota(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		files    map[string]string
+		expected float64
+		ok       bool
+	}{
+		{name: "no cgroup"},
+		{name: "v2, 4 CPUs", files: map[string]string{"cpu.max": "400000 100000\n"}, expected: 4, ok: true},
+		{name: "v2, fractional", files: map[string]string{"cpu.max": "150000 100000\n"}, expected: 1.5, ok: true},
+		{name: "v2, no limit", files: map[string]string{"cpu.max": "max 100000\n"}},
+		{name: "v1, 2 CPUs", files: map[string]string{"cpu/cpu.cfs_quota_us": "200000\n", "cpu/cpu.cfs_period_us": "100000\n"}, expected: 2, ok: true},
+		{name: "v1, no limit", files: map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tcase.files)
+
+			quota, ok := cpuQuota([]string{root}, root)
+			testutil.Equals(t, tcase.ok, ok)
+			testutil.Equals(t, tcase.expected, quota)
+		})
+	}
+
+	t.Run("effective CPUs", func(t *testing.T) {
+		root := t.TempDir()
+		procCgroup := filepath.Join(root, "missing")
+		writeFiles(t, root, map[string]string{"cpu.max": "100 100000\n"})
+		testutil.Equals(t, 1, effectiveCPUs(procCgroup, root))
+
+		writeFiles(t, root, map[string]string{"cpu.max": "max 100000\n"})
+		testutil.Equals(t, runtime.GOMAXPROCS(0), effectiveCPUs(procCgroup, root))
+
+		// Limit of the process cgroup.
+		procCgroup = filepath.Join(t.TempDir(), "cgroup")
+		writeFiles(t, filepath.Dir(procCgroup), map[string]string{"cgroup": "0::/slice/app\n"})
+		writeFiles(t, root, map[string]string{"slice/app/cpu.max": "100 100000\n"})
+		testutil.Equals(t, 1, effectiveCPUs(procCgroup, root))
+
+		// Limit of the parent, process cgroup is not limited.
+		writeFiles(t, root, map[string]string{"slice/app/cpu.max": "max 100000\n", "slice/cpu.max": "100 100000\n"})
+		testutil.Equals(t, 1, effectiveCPUs(procCgroup, root))
+	})
+	t.Run("smallest of ancestors", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{
+			"cpu.max":           "max 100000\n",
+			"a/cpu.max":         "200000 100000\n",
+			"a/b/cpu.max":       "max 100000\n",
+			"a/b/c/cpu.max":     "400000 100000\n",
+			"a/b/c/d/cpu.max":   "invalid\n",
+			"a/b/c/d/e/cpu.max": "max 100000\n",
+		})
+		dirs := []string{"a/b/c/d/e", "a/b/c/d", "a/b/c", "a/b", "a", ""}
+		for i := range dirs {
+			dirs[i] = filepath.Join(root, dirs[i])
+		}
+		quota, ok := cpuQuota(dirs, root)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 2.0, quota)
+	})
+}
+
+func TestCgroupDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, tcase := range []struct {
+		name       string
+		procCgroup string
+		expected   []string
+	}{
+		{name: "v1 only", procCgroup: "12:memory:/app\n1:cpu,cpuacct:/app\n", expected: []string{"/sys/fs/cgroup"}},
+		{name: "v2 root", procCgroup: "0::/\n", expected: []string{"/sys/fs/cgroup"}},
+		{name: "v2", procCgroup: "0::/system.slice/app.service\n", expected: []string{"/sys/fs/cgroup/system.slice/app.service", "/sys/fs/cgroup/system.slice", "/sys/fs/cgroup"}},
+		{name: "hybrid", procCgroup: "1:name=systemd:/app\n0::/app\n", expected: []string{"/sys/fs/cgroup/app", "/sys/fs/cgroup"}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			procCgroup := filepath.Join(dir, "cgroup")
+			testutil.Ok(t, os.WriteFile(procCgroup, []byte(tcase.procCgroup), os.ModePerm))
+			testutil.Equals(t, tcase.expected, cgroupDirs(procCgroup, "/sys/fs/cgroup"))
+		})
+	}
+	t.Run("unreadable", func(t *testing.T) {
+		testutil.Equals(t, []string{"/sys/fs/cgroup"}, cgroupDirs(filepath.Join(dir, "missing"), "/sys/fs/cgroup"))
+	})
+}
+
+func TestAvailableMemory(t *testing.T) {
+	const meminfo = "MemTotal:       16000000 kB\nMemFree:         1000000 kB\nMemAvailable:    8000000 kB\n"
+
+	for _, tcase := range []struct {
+		name     string
+		files    map[string]string
+		expected int64
+	}{
+		{name: "nothing", expected: -1},
+		{name: "meminfo only", files: map[string]string{"meminfo": meminfo}, expected: 8000000 * 1024},
+		{name: "v2 limit", files: map[string]string{"meminfo": meminfo, "cgroup/memory.max": "1000\n", "cgroup/memory.current": "400\n"}, expected: 600},
+		{name: "v2 no limit", files: map[string]string{"meminfo": meminfo, "cgroup/memory.max": "max\n"}, expected: 8000000 * 1024},
+		{name: "v2 limit without meminfo", files: map[string]string{"cgroup/memory.max": "1000\n"}, expected: 1000},
+		{name: "v2 limit of the process cgroup", files: map[string]string{"meminfo": meminfo, "self_cgroup": "0::/user.slice/app\n", "cgroup/memory.max": "1000\n", "cgroup/user.slice/app/memory.max": "500\n"}, expected: 500},
+		{name: "v2 no limit of the process cgroup, limited parent", files: map[string]string{"meminfo": meminfo, "self_cgroup": "0::/app\n", "cgroup/memory.max": "1000\n", "cgroup/app/memory.max": "max\n"}, expected: 1000},
+		{name: "v2 limited slice", files: map[string]string{"meminfo": meminfo, "self_cgroup": "0::/user.slice/app\n", "cgroup/memory.max": "max\n", "cgroup/user.slice/memory.max": "2000\n", "cgroup/user.slice/memory.current": "500\n", "cgroup/user.slice/app/memory.max": "max\n"}, expected: 1500},
+		{name: "v2 less memory left in parent", files: map[string]string{"meminfo": meminfo, "self_cgroup": "0::/app\n", "cgroup/memory.max": "1000\n", "cgroup/memory.current": "800\n", "cgroup/app/memory.max": "500\n"}, expected: 200},
+		{name: "v2 no limits", files: map[string]string{"meminfo": meminfo, "self_cgroup": "0::/app\n", "cgroup/memory.max": "max\n", "cgroup/app/memory.max": "max\n"}, expected: 8000000 * 1024},
+		{name: "v1 limit", files: map[string]string{"meminfo": meminfo, "cgroup/memory/memory.limit_in_bytes": "1000\n", "cgroup/memory/memory.usage_in_bytes": "100\n"}, expected: 900},
+		{name: "v1 no limit", files: map[string]string{"meminfo": meminfo, "cgroup/memory/memory.limit_in_bytes": "9223372036854771712\n"}, expected: 8000000 * 1024},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tcase.files)
+
+			testutil.Equals(t, tcase.expected, availableMemory(filepath.Join(root, "meminfo"), filepath.Join(root, "self_cgroup"), filepath.Join(root, "cgroup")))
+		})
+	}
+}
+
+func TestSumAuto(t *testing.T) {
+	for _, numLines := range []int{0, 10, 2e6} {
+		testFile := filepath.Join(t.TempDir(), "input.txt")
+		expectedSum, err := createTestInputWithExpectedResult(testFile, numLines)
+		testutil.Ok(t, err)
+
+		p, err := NewPlan(testFile)
+		testutil.Ok(t, err)
+		t.Log(p)
+
+		ret, err := SumAuto(testFile)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	}
+}
+
+func TestSumAuto_Compressed(t *testing.T) {
+	for _, numLines := range []int{10, 5e5} {
+		buf := bytes.Buffer{}
+		expectedSum, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, numLines)
+		testutil.Ok(t, err)
+
+		for c := range compressors {
+			t.Run(fmt.Sprintf("%v lines, %v", numLines, c), func(t *testing.T) {
+				testFile := filepath.Join(t.TempDir(), "input.txt")
+				testutil.Ok(t, os.WriteFile(testFile, compress(t, c, buf.Bytes()), os.ModePerm))
+
+				p, err := NewPlan(testFile)
+				testutil.Ok(t, err)
+				testutil.Equals(t, c, p.Compression)
+
+				// Plan for the same size of plain file would be different, but the result has to be the same.
+				for _, p := range []Plan{
+					p,
+					newPlan(p.FileSize, c, -1, 1),
+					{Strategy: StrategyInMemory, Workers: 1, Compression: c},
+					{Strategy: StrategySharded, Workers: 4, Compression: c},
+				} {
+					ret, err := p.Sum(testFile)
+					testutil.Ok(t, err)
+					testutil.Equals(t, expectedSum, ret, p.String())
+				}
+
+				ret, err := SumAuto(testFile)
+				testutil.Ok(t, err)
+				testutil.Equals(t, expectedSum, ret)
+			})
+		}
+	}
+}
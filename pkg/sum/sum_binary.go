@@ -0,0 +1,307 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+)
+
+// BinaryEncoding is the encoding of integers in the binary format.
+//
+// Binary format is an 8 bytes header: "SUMB" magic, version (1), encoding and two reserved zero bytes,
+// followed by integers in the given encoding, without any separators. It's much faster to sum than text,
+// because nothing has to be parsed.
+type BinaryEncoding uint8
+
+const (
+	// BinaryFixed64 encodes each integer as 8 bytes little-endian int64.
+	BinaryFixed64 BinaryEncoding = 1
+	// BinaryVarint encodes each integer as zigzag varint (see binary.PutVarint), so small numbers take
+	// one or two bytes instead of eight.
+	BinaryVarint BinaryEncoding = 2
+)
+
+func (e BinaryEncoding) String() string {
+	switch e {
+	case BinaryFixed64:
+		return "fixed64"
+	case BinaryVarint:
+		return "varint"
+	}
+	return "unknown"
+}
+
+const (
+	binaryMagic     = "SUMB"
+	binaryVersion   = 1
+	binaryHeaderLen = 8
+)
+
+func binaryHeader(e BinaryEncoding) []byte {
+	return []byte{binaryMagic[0], binaryMagic[1], binaryMagic[2], binaryMagic[3], binaryVersion, byte(e), 0, 0}
+}
+
+// parseBinaryHeader validates the header and returns encoding of the integers that follow it.
+func parseBinaryHeader(h []byte) (BinaryEncoding, error) {
+	if len(h) < binaryHeaderLen || !bytes.HasPrefix(h, []byte(binaryMagic)) {
+		return 0, errors.New("not a binary sum file, missing header")
+	}
+	if h[4] != binaryVersion {
+		return 0, errors.Newf("unsupported binary format version %v", h[4])
+	}
+	e := BinaryEncoding(h[5])
+	if e != BinaryFixed64 && e != BinaryVarint {
+		return 0, errors.Newf("unsupported binary encoding %v", h[5])
+	}
+	return e, nil
+}
+
+// ConvertToBinary reads integers in the DefaultFormat from r and writes them in the binary format with the given
+// encoding to w. It returns number of integers written. Numbers out of int64 range fail the conversion (with error
+// wrapping ErrOverflow), so they are never written as wrapped values.
+func ConvertToBinary(w io.Writer, r io.Reader, e BinaryEncoding) (n int64, err error) {
+	if e != BinaryFixed64 && e != BinaryVarint {
+		return 0, errors.Newf("unsupported binary encoding %v", e)
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(binaryHeader(e)); err != nil {
+		return 0, err
+	}
+
+	var enc [binary.MaxVarintLen64]byte
+	if err := forEachTokenReader(r, make([]byte, 8*1024), func(tok []byte) error {
+		num, err := ParseIntChecked(tok)
+		if err != nil {
+			return err
+		}
+
+		// Write errors are sticky, so we check them once on flush.
+		if e == BinaryFixed64 {
+			binary.LittleEndian.PutUint64(enc[:], uint64(num))
+			_, _ = bw.Write(enc[:8])
+		} else {
+			_, _ = bw.Write(enc[:binary.PutVarint(enc[:], num)])
+		}
+		n++
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return n, bw.Flush()
+}
+
+// ConvertFileToBinary is like ConvertToBinary, but for files.
+func ConvertFileToBinary(dst, src string, e BinaryEncoding) (n int64, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, in.Close, "close source")
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, out.Close, "close destination")
+
+	return ConvertToBinary(out, in, e)
+}
+
+// sumFixed64 sums little-endian int64s from b. len(b) has to be multiple of 8.
+func sumFixed64(b []byte) (ret int64) {
+	for ; len(b) >= 8; b = b[8:] {
+		ret += int64(binary.LittleEndian.Uint64(b))
+	}
+	return ret
+}
+
+// sumVarint sums zigzag varints from b. It returns number of bytes consumed, which is less than len(b) if
+// the last varint is truncated.
+func sumVarint(b []byte) (ret int64, n int, _ error) {
+	for n < len(b) {
+		num, l := binary.Varint(b[n:])
+		if l == 0 {
+			// Truncated.
+			return ret, n, nil
+		}
+		if l < 0 {
+			return 0, n, errors.Newf("varint at body offset %v overflows 64 bits", n)
+		}
+		ret += num
+		n += l
+	}
+	return ret, n, nil
+}
+
+// sumBinaryBody sums integers from the binary format body (without header).
+func sumBinaryBody(b []byte, e BinaryEncoding) (int64, error) {
+	if e == BinaryFixed64 {
+		if len(b)%8 != 0 {
+			return 0, errors.Newf("truncated fixed64 body of %v bytes", len(b))
+		}
+		return sumFixed64(b), nil
+	}
+
+	ret, n, err := sumVarint(b)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(b) {
+		return 0, errors.Newf("truncated varint at body offset %v", n)
+	}
+	return ret, nil
+}
+
+// SumBinary is like Sum4, but for the binary format (see BinaryEncoding).
+func SumBinary(fileName string) (int64, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	e, err := parseBinaryHeader(b)
+	if err != nil {
+		return 0, err
+	}
+	return sumBinaryBody(b[binaryHeaderLen:], e)
+}
+
+// SumBinaryReader is like Sum6Reader, but for the binary format (see BinaryEncoding).
+// Buffer has to fit at least two varints of maximum length (2*binary.MaxVarintLen64, so 20 bytes).
+func SumBinaryReader(r io.Reader, buf []byte) (ret int64, err error) {
+	if len(buf) < 2*binary.MaxVarintLen64 {
+		return 0, errors.Newf("buffer has to have at least %v bytes, got %v", 2*binary.MaxVarintLen64, len(buf))
+	}
+	if _, err := io.ReadFull(r, buf[:binaryHeaderLen]); err != nil {
+		return 0, errors.Wrap(err, "read header")
+	}
+	e, err := parseBinaryHeader(buf[:binaryHeaderLen])
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		offset, n int
+		consumed  int64
+	)
+	for err != io.EOF {
+		n, err = r.Read(buf[offset:])
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		n += offset
+
+		var (
+			last int
+			sum  int64
+		)
+		if e == BinaryFixed64 {
+			last = n - n%8
+			sum = sumFixed64(buf[:last])
+		} else {
+			var sErr error
+			if sum, last, sErr = sumVarint(buf[:n]); sErr != nil {
+				return 0, errors.Newf("varint at body offset %v overflows 64 bits", consumed+int64(last))
+			}
+		}
+		ret += sum
+
+		consumed += int64(last)
+		offset = n - last
+		if offset > 0 {
+			_ = copy(buf, buf[last:n])
+		}
+	}
+
+	if offset > 0 {
+		return 0, errors.Newf("truncated %v body at offset %v", e, consumed)
+	}
+	return ret, nil
+}
+
+// binaryShardedRange is like shardedRange, but for the binary format body. For varints it uses the fact
+// that only the last byte of each varint has the most significant bit clear.
+// The last worker takes the remainder.
+func binaryShardedRange(routineNumber int, workers int, b []byte, e BinaryEncoding) (int, int) {
+	bytesPerWorker := len(b) / workers
+	if e == BinaryFixed64 {
+		bytesPerWorker -= bytesPerWorker % 8
+	}
+
+	begin := routineNumber * bytesPerWorker
+	end := begin + bytesPerWorker
+	if routineNumber == workers-1 {
+		end = len(b)
+	}
+	if e == BinaryFixed64 {
+		return begin, end
+	}
+	return varintBegin(b, begin), varintBegin(b, end)
+}
+
+// varintBegin returns beginning of the varint containing b[pos] (or pos, if it's the end of b).
+func varintBegin(b []byte, pos int) int {
+	if pos >= len(b) {
+		return pos
+	}
+	for pos > 0 && b[pos-1]&0x80 != 0 {
+		pos--
+	}
+	return pos
+}
+
+// ConcurrentSumBinary is like ConcurrentSum3, but for the binary format (see BinaryEncoding).
+func ConcurrentSumBinary(fileName string, workers int) (ret int64, err error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	e, err := parseBinaryHeader(b)
+	if err != nil {
+		return 0, err
+	}
+	b = b[binaryHeaderLen:]
+	if e == BinaryFixed64 && len(b)%8 != 0 {
+		return 0, errors.Newf("truncated fixed64 body of %v bytes", len(b))
+	}
+
+	// Each worker needs at least one integer, otherwise shards would be empty.
+	minBytes := 1
+	if e == BinaryFixed64 {
+		minBytes = 8
+	}
+	if workers > len(b)/minBytes {
+		workers = len(b) / minBytes
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	resultCh := make(chan result)
+
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			begin, end := binaryShardedRange(i, workers, b, e)
+
+			sum, err := sumBinaryBody(b[begin:end], e)
+			if err != nil {
+				err = errors.Wrapf(err, "shard starting at body offset %v", begin)
+			}
+			resultCh <- result{sum: sum, err: err}
+		}(i)
+	}
+
+	ret, err = collect(resultCh, workers)
+	close(resultCh)
+	return ret, err
+}
@@ -0,0 +1,189 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+)
+
+func TestSumBinary(t *testing.T) {
+	for _, e := range []BinaryEncoding{BinaryFixed64, BinaryVarint} {
+		t.Run(e.String(), func(t *testing.T) {
+			buf := bytes.Buffer{}
+			expectedSum, err := sumtestutil.CreateBinaryTestInputWithExpectedResult(&buf, 1e5, uint8(e))
+			testutil.Ok(t, err)
+
+			// sumtestutil duplicates the header, make sure it's in sync.
+			testutil.Equals(t, binaryHeader(e), buf.Bytes()[:binaryHeaderLen])
+
+			testFile := filepath.Join(t.TempDir(), "input.bin")
+			testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+			ret, err := SumBinary(testFile)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expectedSum, ret)
+
+			for _, bufSize := range []int{20, 33, 8 * 1024} {
+				ret, err = SumBinaryReader(bytes.NewReader(buf.Bytes()), make([]byte, bufSize))
+				testutil.Ok(t, err)
+				testutil.Equals(t, expectedSum, ret)
+			}
+
+			for _, workers := range []int{1, 3, 4, 11} {
+				ret, err = ConcurrentSumBinary(testFile, workers)
+				testutil.Ok(t, err)
+				testutil.Equals(t, expectedSum, ret)
+			}
+		})
+	}
+}
+
+func TestConcurrentSumBinary_MoreWorkersThanIntegers(t *testing.T) {
+	for _, e := range []BinaryEncoding{BinaryFixed64, BinaryVarint} {
+		for _, numLen := range []int{0, 10} {
+			t.Run(fmt.Sprintf("%v-%v", e, numLen), func(t *testing.T) {
+				buf := bytes.Buffer{}
+				expectedSum, err := sumtestutil.CreateBinaryTestInputWithExpectedResult(&buf, numLen, uint8(e))
+				testutil.Ok(t, err)
+
+				testFile := filepath.Join(t.TempDir(), "input.bin")
+				testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+				ret, err := ConcurrentSumBinary(testFile, 100)
+				testutil.Ok(t, err)
+				testutil.Equals(t, expectedSum, ret)
+			})
+		}
+	}
+}
+
+func TestConvertToBinary(t *testing.T) {
+	text := bytes.Buffer{}
+	expectedSum, err := sumtestutil.CreateTestInputWithExpectedResult(&text, 1e4)
+	testutil.Ok(t, err)
+	text.WriteString("\n-1\n-4611686018427387904") // Blank line and final line without newline.
+	expectedSum += -1 - 1<<62
+
+	for _, e := range []BinaryEncoding{BinaryFixed64, BinaryVarint} {
+		t.Run(e.String(), func(t *testing.T) {
+			bin := bytes.Buffer{}
+			n, err := ConvertToBinary(&bin, bytes.NewReader(text.Bytes()), e)
+			testutil.Ok(t, err)
+			testutil.Equals(t, int64(1e4+2), n)
+
+			ret, err := SumBinaryReader(&bin, make([]byte, 1024))
+			testutil.Ok(t, err)
+			testutil.Equals(t, expectedSum, ret)
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		dir := t.TempDir()
+		src, dst := filepath.Join(dir, "input.txt"), filepath.Join(dir, "input.bin")
+		testutil.Ok(t, os.WriteFile(src, text.Bytes(), os.ModePerm))
+
+		_, err := ConvertFileToBinary(dst, src, BinaryVarint)
+		testutil.Ok(t, err)
+
+		ret, err := SumBinary(dst)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := ConvertToBinary(&bytes.Buffer{}, bytes.NewReader([]byte("1\n12a4\n")), BinaryVarint)
+		testutil.NotOk(t, err)
+
+		var pErr *ParseError
+		testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+		testutil.Equals(t, 2, pErr.Line)
+	})
+	t.Run("out of range", func(t *testing.T) {
+		for _, in := range []string{"1\n12345678901234567890\n", "1\n-9223372036854775809\n"} {
+			_, err := ConvertToBinary(&bytes.Buffer{}, bytes.NewReader([]byte(in)), BinaryFixed64)
+			testutil.NotOk(t, err)
+			testutil.Assert(t, errors.Is(err, ErrOverflow), "expected ErrOverflow, got %v", err)
+		}
+	})
+}
+
+func TestSumBinary_InvalidInput(t *testing.T) {
+	valid := bytes.Buffer{}
+	_, err := sumtestutil.CreateBinaryTestInputWithExpectedResult(&valid, 10, sumtestutil.BinaryVarint)
+	testutil.Ok(t, err)
+
+	for _, tcase := range []struct {
+		name  string
+		input []byte
+	}{
+		{name: "text", input: []byte("123\n43\n632\n22\n")},
+		{name: "short header", input: []byte("SUMB")},
+		{name: "unknown version", input: []byte("SUMB\x02\x01\x00\x00")},
+		{name: "unknown encoding", input: []byte("SUMB\x01\x03\x00\x00")},
+		{name: "truncated fixed64", input: append(binaryHeader(BinaryFixed64), 1, 2, 3)},
+		{name: "truncated varint", input: valid.Bytes()[:valid.Len()-1]},
+		{name: "varint overflow", input: append(binaryHeader(BinaryVarint), bytes.Repeat([]byte{0xff}, 11)...)},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), "input.bin")
+			testutil.Ok(t, os.WriteFile(testFile, tcase.input, os.ModePerm))
+
+			_, err := SumBinary(testFile)
+			testutil.NotOk(t, err)
+			_, err = SumBinaryReader(bytes.NewReader(tcase.input), make([]byte, 1024))
+			testutil.NotOk(t, err)
+			_, err = ConcurrentSumBinary(testFile, 4)
+			testutil.NotOk(t, err)
+		})
+	}
+}
+
+// BenchmarkSumBinary compares binary formats with the text one.
+// Recommended run options:
+/*
+export ver=v1bin && go test \
+    -run '^$' -bench '^BenchmarkSumBinary$' \
+    -benchtime 10s -count 6 -cpu 4 -benchmem \
+  | tee ${ver}.txt
+*/
+func BenchmarkSumBinary(b *testing.B) {
+	dir := b.TempDir()
+	fn := lazyCreateTestInput(b, 2e6)
+
+	fixedFn := filepath.Join(dir, "input.fixed64.bin")
+	_, err := ConvertFileToBinary(fixedFn, fn, BinaryFixed64)
+	testutil.Ok(b, err)
+	varintFn := filepath.Join(dir, "input.varint.bin")
+	_, err = ConvertFileToBinary(varintFn, fn, BinaryVarint)
+	testutil.Ok(b, err)
+
+	for _, tcase := range []struct {
+		name string
+		f    func() (int64, error)
+	}{
+		{name: "Sum4", f: func() (int64, error) { return Sum4(fn) }},
+		{name: "SumBinary/fixed64", f: func() (int64, error) { return SumBinary(fixedFn) }},
+		{name: "SumBinary/varint", f: func() (int64, error) { return SumBinary(varintFn) }},
+		{name: "ConcurrentSum3", f: func() (int64, error) { return ConcurrentSum3(fn, 4) }},
+		{name: "ConcurrentSumBinary/fixed64", f: func() (int64, error) { return ConcurrentSumBinary(fixedFn, 4) }},
+		{name: "ConcurrentSumBinary/varint", f: func() (int64, error) { return ConcurrentSumBinary(varintFn, 4) }},
+	} {
+		b.Run(tcase.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, err := tcase.f()
+				testutil.Ok(b, err)
+			}
+		})
+	}
+}
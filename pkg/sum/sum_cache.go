@@ -0,0 +1,147 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/examples/pkg/sum/internal/cache"
+)
+
+// cacheKey identifies the version of the file content. Any write changes mtime (and usually size) and replacing
+// the file (e.g. with rename) changes inode, so a stale result is never returned for the same path.
+type cacheKey struct {
+	Path    string `json:"path"`
+	Inode   uint64 `json:"inode"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time_ns"`
+}
+
+type cacheEntry struct {
+	cacheKey
+	Sum int64 `json:"sum"`
+}
+
+func statCacheKey(fileName string) (cacheKey, error) {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return cacheKey{}, err
+	}
+	return cacheKey{Path: fileName, Inode: inodeOf(fi), Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}, nil
+}
+
+// Cache caches sums of files, so the same file content is summed only once. It is safe for concurrent use.
+// It holds up to maxEntries results and evicts the least recently used ones.
+type Cache struct {
+	sum func(string) (int64, error)
+	// persistFile is empty if cache is not persisted.
+	persistFile string
+	// persistMu serializes writes of the persist file, so older entries never overwrite newer ones.
+	persistMu sync.Mutex
+
+	mu  sync.Mutex
+	lru *cache.LRU[cacheKey, int64]
+}
+
+// NewCache returns in-memory cache for up to maxEntries sums computed with the given function (e.g. Sum4).
+func NewCache(maxEntries int, sum func(string) (int64, error)) *Cache {
+	return &Cache{
+		sum: sum,
+		lru: cache.NewLRU[cacheKey, int64](maxEntries, nil),
+	}
+}
+
+// NewPersistentCache is like NewCache, but it keeps the cache in the given JSON file too, so restarted process
+// starts with warm cache. The file is loaded if it exists and it's rewritten (atomically) on every new result.
+// Failed rewrite does not fail Sum, use Flush to check if the cache was persisted (e.g. before exit). Corrupted file
+// (e.g. written by other tool) is ignored, cache starts empty and the file is overwritten with the first result.
+func NewPersistentCache(file string, maxEntries int, sum func(string) (int64, error)) (*Cache, error) {
+	c := NewCache(maxEntries, sum)
+	c.persistFile = file
+
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []cacheEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		// Cache is only an optimization, it's fine to start cold.
+		return c, nil
+	}
+	// Entries are stored from the most recently used, so we add them in reverse to keep the order.
+	for i := len(entries) - 1; i >= 0; i-- {
+		c.lru.Add(entries[i].cacheKey, entries[i].Sum)
+	}
+	return c, nil
+}
+
+// Sum returns cached sum of the file or computes and caches it, if the file is not cached or it has changed.
+// Concurrent calls for the same uncached file might compute it more than once.
+func (c *Cache) Sum(fileName string) (int64, error) {
+	k, err := statCacheKey(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	s, ok := c.lru.Get(k)
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	// Don't hold the lock while summing, so other files can be served in the meantime.
+	s, err = c.sum(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	// If the file changed while we were reading it, we don't know which version we summed, so don't cache it.
+	if after, err := statCacheKey(fileName); err != nil || after != k {
+		return s, nil
+	}
+
+	c.mu.Lock()
+	c.lru.Add(k, s)
+	c.mu.Unlock()
+
+	// The sum is correct, even if we fail to persist it. The file is rewritten with the next result anyway.
+	_ = c.Flush()
+	return s, nil
+}
+
+// Flush writes all cached results to the persist file, if cache is persisted.
+func (c *Cache) Flush() error {
+	if c.persistFile == "" {
+		return nil
+	}
+
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+
+	c.mu.Lock()
+	entries := make([]cacheEntry, 0, c.lru.Len())
+	c.lru.Range(func(k cacheKey, s int64) bool {
+		entries = append(entries, cacheEntry{cacheKey: k, Sum: s})
+		return true
+	})
+	c.mu.Unlock()
+
+	return errors.Wrap(cache.WriteJSONFile(c.persistFile, entries), "persist cache")
+}
+
+// Len returns number of cached results.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
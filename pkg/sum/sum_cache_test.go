@@ -0,0 +1,207 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+// countingSum returns Sum4 which counts its calls.
+func countingSum(calls *atomic.Int64) func(string) (int64, error) {
+	return func(fn string) (int64, error) {
+		calls.Add(1)
+		return Sum4(fn)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "input.txt")
+	testutil.Ok(t, os.WriteFile(fn, []byte("1\n2\n"), os.ModePerm))
+
+	var calls atomic.Int64
+	c := NewCache(10, countingSum(&calls))
+
+	assertSum := func(t *testing.T, expected int64, expectedCalls int64) {
+		t.Helper()
+
+		ret, err := c.Sum(fn)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, ret)
+		testutil.Equals(t, expectedCalls, calls.Load())
+	}
+
+	assertSum(t, 3, 1)
+	assertSum(t, 3, 1)
+
+	t.Run("changed size", func(t *testing.T) {
+		testutil.Ok(t, os.WriteFile(fn, []byte("1\n2\n3\n"), os.ModePerm))
+		assertSum(t, 6, 2)
+		assertSum(t, 6, 2)
+	})
+	t.Run("changed mtime only", func(t *testing.T) {
+		testutil.Ok(t, os.WriteFile(fn, []byte("1\n2\n4\n"), os.ModePerm))
+		future := time.Now().Add(time.Hour)
+		testutil.Ok(t, os.Chtimes(fn, future, future))
+		assertSum(t, 7, 3)
+	})
+	t.Run("replaced file with the same size and mtime", func(t *testing.T) {
+		fi, err := os.Stat(fn)
+		testutil.Ok(t, err)
+
+		tmp := filepath.Join(dir, "tmp.txt")
+		testutil.Ok(t, os.WriteFile(tmp, []byte("1\n2\n5\n"), os.ModePerm))
+		testutil.Ok(t, os.Chtimes(tmp, fi.ModTime(), fi.ModTime()))
+		testutil.Ok(t, os.Rename(tmp, fn))
+		assertSum(t, 8, 4)
+	})
+	t.Run("missing file", func(t *testing.T) {
+		_, err := c.Sum(filepath.Join(dir, "missing.txt"))
+		testutil.NotOk(t, err)
+	})
+}
+
+func TestCache_LRU(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 4)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("%v.txt", i))
+		testutil.Ok(t, os.WriteFile(files[i], []byte(fmt.Sprintf("%v\n", i)), os.ModePerm))
+	}
+
+	var calls atomic.Int64
+	c := NewCache(2, countingSum(&calls))
+
+	for _, i := range []int{0, 1, 0, 2} {
+		ret, err := c.Sum(files[i])
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(i), ret)
+	}
+	testutil.Equals(t, int64(3), calls.Load())
+	testutil.Equals(t, 2, c.Len())
+
+	// 1 was the least recently used, so it was evicted, 0 was not.
+	_, err := c.Sum(files[0])
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(3), calls.Load())
+	_, err = c.Sum(files[1])
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(4), calls.Load())
+	testutil.Equals(t, 2, c.Len())
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 8)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("%v.txt", i))
+		testutil.Ok(t, os.WriteFile(files[i], []byte(fmt.Sprintf("%v\n", i)), os.ModePerm))
+	}
+
+	var calls atomic.Int64
+	c := NewCache(4, countingSum(&calls))
+
+	wg := sync.WaitGroup{}
+	errCh := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				f := (g + i) % len(files)
+				ret, err := c.Sum(files[f])
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if ret != int64(f) {
+					errCh <- errors.Newf("file %v: expected %v, got %v", f, f, ret)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		testutil.Ok(t, err)
+	}
+	testutil.Equals(t, 4, c.Len())
+}
+
+func TestPersistentCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "cache.json")
+	files := make([]string, 3)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("%v.txt", i))
+		testutil.Ok(t, os.WriteFile(files[i], []byte(fmt.Sprintf("%v\n", i+10)), os.ModePerm))
+	}
+
+	var calls atomic.Int64
+	c, err := NewPersistentCache(cacheFile, 2, countingSum(&calls))
+	testutil.Ok(t, err)
+	for _, fn := range files {
+		_, err := c.Sum(fn)
+		testutil.Ok(t, err)
+	}
+	testutil.Equals(t, int64(3), calls.Load())
+	testutil.Ok(t, c.Flush())
+
+	// Restarted process.
+	calls.Store(0)
+	c, err = NewPersistentCache(cacheFile, 2, countingSum(&calls))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, c.Len())
+
+	for i := len(files) - 1; i >= 0; i-- {
+		ret, err := c.Sum(files[i])
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(i+10), ret)
+	}
+	// Only the evicted one was computed again.
+	testutil.Equals(t, int64(1), calls.Load())
+
+	t.Run("smaller limit after restart", func(t *testing.T) {
+		c, err := NewPersistentCache(cacheFile, 1, countingSum(&calls))
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, c.Len())
+	})
+	t.Run("failed persist", func(t *testing.T) {
+		// Cache file in a directory which does not exist can't be written.
+		c, err := NewPersistentCache(filepath.Join(dir, "missing", "cache.json"), 2, countingSum(&calls))
+		testutil.Ok(t, err)
+
+		ret, err := c.Sum(files[0])
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(10), ret)
+		testutil.Equals(t, 1, c.Len())
+		testutil.NotOk(t, c.Flush())
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		testutil.Ok(t, os.WriteFile(cacheFile, []byte("{"), os.ModePerm))
+		c, err := NewPersistentCache(cacheFile, 2, countingSum(&calls))
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, c.Len())
+
+		// Corrupted file is overwritten.
+		ret, err := c.Sum(files[1])
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(11), ret)
+		testutil.Ok(t, c.Flush())
+		c, err = NewPersistentCache(cacheFile, 2, countingSum(&calls))
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, c.Len())
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"io"
+	"math/big"
+	"math/bits"
+	"os"
+	"sync/atomic"
+
+	"github.com/efficientgo/core/errors"
+)
+
+// ErrOverflow is returned by the checked functions when a number or the sum does not fit in int64.
+var ErrOverflow = errors.New("integer overflow")
+
+// ParseIntChecked is like ParseInt, but it returns error wrapping ErrOverflow for numbers out of int64 range,
+// instead of silently wrapping around.
+func ParseIntChecked(input []byte) (n int64, _ error) {
+	if len(input) == 0 {
+		return 0, errors.Newf("not a valid integer: %v", input)
+	}
+
+	k := 0
+	limit := uint64(1<<63 - 1)
+	if input[0] == '-' {
+		limit++
+		k++
+	}
+	if k == len(input) {
+		return 0, errors.Newf("not a valid integer: %v", input)
+	}
+
+	var u uint64
+	for _, c := range input[k:] {
+		if c < '0' || c > '9' {
+			return 0, errors.Newf("not a valid integer: %v", input)
+		}
+		if u > limit/10 {
+			return 0, errors.Wrapf(ErrOverflow, "number %s", input)
+		}
+		u = u*10 + uint64(c-'0')
+		if u > limit {
+			return 0, errors.Wrapf(ErrOverflow, "number %s", input)
+		}
+	}
+
+	if k > 0 {
+		return -int64(u), nil // For u = 2^63 it wraps exactly to the minimum int64.
+	}
+	return int64(u), nil
+}
+
+// int128 is a minimal 128-bit signed accumulator. Summing into it can't overflow for any realistic input
+// (it would need more than 2^64 numbers), so it's enough to check only if the final result fits in int64.
+// This also means the result does not depend on the order of numbers or how the input was sharded.
+type int128 struct {
+	hi, lo uint64
+}
+
+func (a *int128) add(v int64) {
+	var carry uint64
+	a.lo, carry = bits.Add64(a.lo, uint64(v), 0)
+	a.hi += uint64(v>>63) + carry // Sign extension of v to 128 bits.
+}
+
+func (a *int128) merge(b int128) {
+	var carry uint64
+	a.lo, carry = bits.Add64(a.lo, b.lo, 0)
+	a.hi += b.hi + carry
+}
+
+func (a int128) big() *big.Int {
+	ret := new(big.Int).SetUint64(a.hi)
+	ret.Lsh(ret, 64).Or(ret, new(big.Int).SetUint64(a.lo))
+	if int64(a.hi) < 0 {
+		// Two's complement.
+		ret.Sub(ret, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return ret
+}
+
+func (a int128) int64() (int64, error) {
+	if a.hi != uint64(int64(a.lo)>>63) {
+		return 0, errors.Wrapf(ErrOverflow, "sum %v does not fit in int64", a.big())
+	}
+	return int64(a.lo), nil
+}
+
+// SumChecked is like Sum4, but it detects overflows both while parsing and summing numbers.
+// Numbers are accumulated into 128-bit integer, so ErrOverflow is returned only if the final sum
+// does not fit in int64 (intermediate results might).
+func SumChecked(fileName string) (ret int64, err error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	var stop atomic.Bool
+	acc, err := sumRangeChecked(b, 0, len(b), &stop)
+	if err != nil {
+		return 0, err
+	}
+	return acc.int64()
+}
+
+// parseLineChecked is like Format.ParseInt, but for ParseIntChecked.
+func parseLineChecked(line []byte) (int64, error) {
+	tok, ok, err := DefaultFormat.Token(line)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return ParseIntChecked(tok)
+}
+
+func sumRangeChecked(b []byte, begin, end int, stop *atomic.Bool) (acc int128, _ error) {
+	last := begin
+	for ; begin < end; begin++ {
+		if b[begin] != '\n' {
+			continue
+		}
+		if stop.Load() {
+			return acc, errStopped
+		}
+		num, err := parseLineChecked(b[last:begin])
+		if err != nil {
+			stop.Store(true)
+			return acc, newParseError(b, last, err)
+		}
+		acc.add(num)
+		last = begin + 1
+	}
+
+	if last < end {
+		// Final line without newline.
+		num, err := parseLineChecked(b[last:end])
+		if err != nil {
+			stop.Store(true)
+			return acc, newParseError(b, last, err)
+		}
+		acc.add(num)
+	}
+	return acc, nil
+}
+
+// SumReaderChecked is like Sum6Reader, but with the overflow checks like SumChecked.
+func SumReaderChecked(r io.Reader, buf []byte) (ret int64, err error) {
+	var (
+		offset, n int
+		consumed  int64
+		lines     int
+		acc       int128
+	)
+	for err != io.EOF {
+		if offset == len(buf) {
+			return 0, errors.Newf("line at byte offset %v is longer than the %v bytes buffer", consumed, len(buf))
+		}
+
+		n, err = r.Read(buf[offset:])
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		n += offset
+
+		var last int
+		for i := range buf[:n] {
+			if buf[i] != '\n' {
+				continue
+			}
+			num, err := parseLineChecked(buf[last:i])
+			if err != nil {
+				return 0, &ParseError{Offset: consumed + int64(last), Line: lines + 1, Err: err}
+			}
+
+			acc.add(num)
+			lines++
+			last = i + 1
+		}
+
+		consumed += int64(last)
+		offset = n - last
+		if offset > 0 {
+			_ = copy(buf, buf[last:n])
+		}
+	}
+
+	if offset > 0 {
+		// Final line without newline.
+		num, err := parseLineChecked(buf[:offset])
+		if err != nil {
+			return 0, &ParseError{Offset: consumed, Line: lines + 1, Err: err}
+		}
+		acc.add(num)
+	}
+	return acc.int64()
+}
+
+// ConcurrentSumChecked is like ConcurrentSum3, but with the overflow checks like SumChecked.
+// Thanks to 128-bit partial sums, the result does not depend on number of workers.
+func ConcurrentSumChecked(fileName string, workers int) (ret int64, err error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		acc int128
+		err error
+	}
+
+	var (
+		resultCh = make(chan result)
+		stop     atomic.Bool
+	)
+	workers = shardWorkers(len(b), workers)
+
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			begin, end := shardedRange(i, workers, b)
+
+			acc, err := sumRangeChecked(b, begin, end, &stop)
+			resultCh <- result{acc: acc, err: err}
+		}(i)
+	}
+
+	var acc int128
+	for i := 0; i < workers; i++ {
+		r := <-resultCh
+		if r.err != nil && (err == nil || err == errStopped) {
+			err = r.err
+		}
+		acc.merge(r.acc)
+	}
+	close(resultCh)
+	if err != nil {
+		return 0, err
+	}
+	return acc.int64()
+}
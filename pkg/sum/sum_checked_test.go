@@ -0,0 +1,167 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestParseIntChecked(t *testing.T) {
+	for _, tcase := range []struct {
+		input       string
+		expected    int64
+		expectedErr error
+		invalid     bool
+	}{
+		{input: "0", expected: 0},
+		{input: "-0", expected: 0},
+		{input: "123", expected: 123},
+		{input: "-123", expected: -123},
+		{input: "9223372036854775807", expected: math.MaxInt64},
+		{input: "-9223372036854775808", expected: math.MinInt64},
+		{input: "0000000000000000000000000001", expected: 1},
+		{input: "9223372036854775808", expectedErr: ErrOverflow},
+		{input: "-9223372036854775809", expectedErr: ErrOverflow},
+		{input: "12345678901234567890", expectedErr: ErrOverflow},
+		{input: "99999999999999999999999", expectedErr: ErrOverflow},
+		{input: "", invalid: true},
+		{input: "-", invalid: true},
+		{input: "12a", invalid: true},
+		{input: "+1", invalid: true},
+	} {
+		t.Run(tcase.input, func(t *testing.T) {
+			ret, err := ParseIntChecked([]byte(tcase.input))
+			if tcase.expectedErr != nil {
+				testutil.Assert(t, errors.Is(err, tcase.expectedErr), "expected %v, got %v", tcase.expectedErr, err)
+				return
+			}
+
+			if tcase.invalid {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, ret)
+		})
+	}
+}
+
+func TestSumChecked(t *testing.T) {
+	for _, tcase := range []struct {
+		name        string
+		input       string
+		expected    int64
+		expectedErr error
+	}{
+		{name: "simple", input: "1\n-2\n3\n", expected: 2},
+		{name: "max", input: "9223372036854775806\n1\n", expected: math.MaxInt64},
+		{name: "min", input: "-9223372036854775807\n-1\n", expected: math.MinInt64},
+		{name: "overflow while parsing", input: "1\n9223372036854775808\n", expectedErr: ErrOverflow},
+		{name: "overflow while summing", input: "9223372036854775807\n1\n", expectedErr: ErrOverflow},
+		{name: "underflow while summing", input: "-9223372036854775808\n-1\n", expectedErr: ErrOverflow},
+		{name: "intermediate overflow", input: "9223372036854775807\n9223372036854775807\n-9223372036854775807\n", expected: math.MaxInt64},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), "input.txt")
+			testutil.Ok(t, os.WriteFile(testFile, []byte(tcase.input), os.ModePerm))
+
+			for _, f := range []func(string) (int64, error){
+				SumChecked,
+				func(fn string) (int64, error) {
+					b, err := os.ReadFile(fn)
+					testutil.Ok(t, err)
+					return SumReaderChecked(bytes.NewReader(b), make([]byte, 32))
+				},
+				func(fn string) (int64, error) { return ConcurrentSumChecked(fn, 1) },
+				func(fn string) (int64, error) { return ConcurrentSumChecked(fn, 2) },
+			} {
+				ret, err := f(testFile)
+				if tcase.expectedErr != nil {
+					testutil.Assert(t, errors.Is(err, tcase.expectedErr), "expected %v, got %v", tcase.expectedErr, err)
+					continue
+				}
+				testutil.Ok(t, err)
+				testutil.Equals(t, tcase.expected, ret)
+			}
+		})
+	}
+
+	t.Run("large input", func(t *testing.T) {
+		testFile := filepath.Join(t.TempDir(), "input.txt")
+		expectedSum, err := createTestInputWithExpectedResult(testFile, 2e5)
+		testutil.Ok(t, err)
+
+		ret, err := SumChecked(testFile)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+
+		f, err := os.Open(testFile)
+		testutil.Ok(t, err)
+		t.Cleanup(func() { _ = f.Close() })
+		ret, err = SumReaderChecked(f, make([]byte, 8*1024))
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+
+		ret, err = ConcurrentSumChecked(testFile, 4)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	})
+}
+
+// BenchmarkSumChecked shows the cost of the overflow checks compared to the unchecked fast path.
+// Recommended run options:
+// $ export ver=v1checked && go test -run '^$' -bench '^BenchmarkSumChecked$' -benchtime 10s -count 6 -cpu 4 -benchmem | tee ${ver}.txt
+func BenchmarkSumChecked(b *testing.B) {
+	fn := lazyCreateTestInput(b, 2e6)
+
+	for _, tcase := range []struct {
+		name string
+		f    func(string) (int64, error)
+	}{
+		{name: "Sum4", f: Sum4},
+		{name: "SumChecked", f: SumChecked},
+		{name: "Sum6", f: Sum6},
+		{name: "SumReaderChecked", f: func(fn string) (int64, error) {
+			f, err := os.Open(fn)
+			if err != nil {
+				return 0, err
+			}
+			defer f.Close()
+			return SumReaderChecked(f, make([]byte, 8*1024))
+		}},
+		{name: "ConcurrentSum3", f: func(fn string) (int64, error) { return ConcurrentSum3(fn, 4) }},
+		{name: "ConcurrentSumChecked", f: func(fn string) (int64, error) { return ConcurrentSumChecked(fn, 4) }},
+	} {
+		b.Run(tcase.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, err := tcase.f(fn)
+				testutil.Ok(b, err)
+			}
+		})
+	}
+}
+
+func BenchmarkParseIntChecked(b *testing.B) {
+	input := []byte("-1234567890123")
+
+	b.Run("ParseInt", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ParseInt(input)
+		}
+	})
+	b.Run("ParseIntChecked", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ParseIntChecked(input)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression of the input, detected from its first bytes.
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Zstd
+	// Snappy is the snappy framing format (not the raw block format, which has no magic bytes).
+	Snappy
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	}
+	return "unknown"
+}
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// magicLen is the number of bytes needed to detect any supported compression.
+const magicLen = 10
+
+// DetectCompression returns compression of the input starting with the given header. None of the magic bytes
+// are digits, signs or whitespace, so valid plain input is never detected as compressed.
+//
+// ConcurrentSumN functions and SumPool.SumFile use it to accept compressed files too. Compressed input can't be
+// sharded without decompressing it first, so they sum it in a single stream.
+func DetectCompression(header []byte) Compression {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return Zstd
+	case bytes.HasPrefix(header, snappyMagic):
+		return Snappy
+	}
+	return NoCompression
+}
+
+// Decompress detects compression of r by its magic bytes and returns reader with decompressed content.
+// Plain input is returned as is (except for the first few bytes read for detection), so it costs nothing.
+// Close releases decompressor resources, it does not close r.
+func Decompress(r io.Reader) (io.ReadCloser, Compression, error) {
+	header := make([]byte, magicLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, NoCompression, err
+	}
+	header = header[:n]
+	r = io.MultiReader(bytes.NewReader(header), r)
+
+	c := DetectCompression(header)
+	switch c {
+	case Gzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, c, errors.Wrap(err, "gzip")
+		}
+		return gr, c, nil
+	case Zstd:
+		// Single goroutine is enough for streaming, we parse slower than zstd decompresses anyway.
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, c, errors.Wrap(err, "zstd")
+		}
+		return zr.IOReadCloser(), c, nil
+	case Snappy:
+		return io.NopCloser(snappy.NewReader(r)), c, nil
+	}
+	return io.NopCloser(r), c, nil
+}
+
+// SumCompressedReader is like SumReaderContext, but it transparently decompresses gzip, zstd or snappy input.
+// Progress and ParseError offsets refer to the decompressed content.
+func SumCompressedReader(ctx context.Context, r io.Reader, buf []byte, progress func(Progress)) (_ int64, err error) {
+	dr, _, err := Decompress(r)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, dr.Close, "close decompressor")
+
+	return sumReader(dr, buf, DefaultFormat, ctx.Err, progress)
+}
+
+// sumCompressed sums compressed input from r in a single stream.
+func sumCompressed(r io.Reader, f Format) (_ int64, err error) {
+	dr, _, err := Decompress(r)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, dr.Close, "close decompressor")
+
+	return sumReader(dr, make([]byte, 8*1024), f, func() error { return nil }, nil)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var compressors = map[Compression]func(w io.Writer) io.WriteCloser{
+	Gzip: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	Zstd: func(w io.Writer) io.WriteCloser {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			panic(err)
+		}
+		return zw
+	},
+	Snappy: func(w io.Writer) io.WriteCloser { return snappy.NewBufferedWriter(w) },
+}
+
+func compress(tb testing.TB, c Compression, b []byte) []byte {
+	tb.Helper()
+
+	buf := bytes.Buffer{}
+	w := compressors[c](&buf)
+	_, err := w.Write(b)
+	testutil.Ok(tb, err)
+	testutil.Ok(tb, w.Close())
+	return buf.Bytes()
+}
+
+func TestDetectCompression(t *testing.T) {
+	plain := []byte("123\n-3\n")
+	for c := range compressors {
+		t.Run(c.String(), func(t *testing.T) {
+			b := compress(t, c, plain)
+			testutil.Equals(t, c, DetectCompression(b))
+			testutil.Equals(t, c, DetectCompression(b[:magicLen]))
+		})
+	}
+	testutil.Equals(t, NoCompression, DetectCompression(plain))
+	testutil.Equals(t, NoCompression, DetectCompression(nil))
+	testutil.Equals(t, NoCompression, DetectCompression(gzipMagic[:1]))
+}
+
+func TestSum_Compressed(t *testing.T) {
+	buf := bytes.Buffer{}
+	expectedSum, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e5)
+	testutil.Ok(t, err)
+
+	for c := range compressors {
+		t.Run(c.String(), func(t *testing.T) {
+			b := compress(t, c, buf.Bytes())
+			testFile := filepath.Join(t.TempDir(), "input.txt")
+			testutil.Ok(t, os.WriteFile(testFile, b, os.ModePerm))
+
+			ret, err := SumCompressedReader(context.Background(), bytes.NewReader(b), make([]byte, 1024), nil)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expectedSum, ret)
+
+			ret, err = ConcurrentSum1(testFile)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expectedSum, ret)
+
+			for _, f := range []func(string, int) (int64, error){
+				ConcurrentSum2, ConcurrentSum3, ConcurrentSum4, ConcurrentSumMmap,
+			} {
+				ret, err := f(testFile, 4)
+				testutil.Ok(t, err)
+				testutil.Equals(t, expectedSum, ret)
+			}
+		})
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		ret, err := SumCompressedReader(context.Background(), bytes.NewReader(buf.Bytes()), make([]byte, 1024), nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+
+		// Shorter than the magic bytes.
+		ret, err = SumCompressedReader(context.Background(), bytes.NewReader([]byte("12")), make([]byte, 1024), nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(12), ret)
+	})
+}
+
+func TestSumCompressedReader_InvalidInput(t *testing.T) {
+	in := []byte("1\n2\n12a4\n")
+	for c := range compressors {
+		t.Run(c.String(), func(t *testing.T) {
+			_, err := SumCompressedReader(context.Background(), bytes.NewReader(compress(t, c, in)), make([]byte, 1024), nil)
+			testutil.NotOk(t, err)
+
+			// Errors point to the decompressed content.
+			var pErr *ParseError
+			testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+			testutil.Equals(t, int64(4), pErr.Offset)
+			testutil.Equals(t, 3, pErr.Line)
+		})
+
+		t.Run(c.String()+"-corrupted", func(t *testing.T) {
+			b := compress(t, c, in)
+			_, err := SumCompressedReader(context.Background(), bytes.NewReader(b[:len(b)-3]), make([]byte, 1024), nil)
+			testutil.NotOk(t, err)
+		})
+	}
+}
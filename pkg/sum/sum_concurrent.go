@@ -5,7 +5,7 @@ package sum
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"io"
 	"io/ioutil"
 	"os"
@@ -23,30 +23,58 @@ func ConcurrentSum1(fileName string) (ret int64, _ error) {
 	if err != nil {
 		return 0, err
 	}
+	if DetectCompression(b) != NoCompression {
+		return sumCompressed(bytes.NewReader(b), DefaultFormat)
+	}
+	b = terminated(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	var wg sync.WaitGroup
-	var last int
+	var (
+		wg    sync.WaitGroup
+		errCh = make(chan error, 1)
+		last  int
+	)
 	for i := 0; i < len(b); i++ {
 		if b[i] != '\n' {
 			continue
 		}
+		if ctx.Err() != nil {
+			break
+		}
 
 		wg.Add(1)
-		go func(line []byte) { // Creation of goroutine turns to be mem intensive on scale! (on top of time)
+		go func(begin int, line []byte) { // Creation of goroutine turns to be mem intensive on scale! (on top of time)
 			defer wg.Done()
-			num, err := ParseInt(line)
+			num, _, err := DefaultFormat.ParseInt(line)
 			if err != nil {
-				// TODO(bwplotka): Return err using other channel.
+				sendFirstErr(errCh, newParseError(b, begin, err))
+				cancel()
 				return
 			}
 			atomic.AddInt64(&ret, num)
-		}(b[last:i])
+		}(last, b[last:i])
 		last = i + 1
 	}
 	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return 0, err
+	default:
+	}
 	return ret, nil
 }
 
+// sendFirstErr sends error to the channel with buffer of one, unless other error was sent already.
+func sendFirstErr(errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	default:
+	}
+}
+
 // ConcurrentSum2 performs sum concurrently. A lot slower than ConcurrentSum3. An example of pessimisation.
 // Read more in "Efficient Go"; Example 10-11.
 func ConcurrentSum2(fileName string, workers int) (ret int64, _ error) {
@@ -54,57 +82,157 @@ func ConcurrentSum2(fileName string, workers int) (ret int64, _ error) {
 	if err != nil {
 		return 0, err
 	}
+	if DetectCompression(b) != NoCompression {
+		return sumCompressed(bytes.NewReader(b), DefaultFormat)
+	}
+	b = terminated(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	var (
 		wg     = sync.WaitGroup{}
 		workCh = make(chan []byte, workers)
+		errCh  = make(chan error, 1)
 	)
 
 	wg.Add(workers + 1)
 	go func() {
+		defer wg.Done()
+		defer close(workCh)
+
 		var last int
 		for i := 0; i < len(b); i++ {
 			if b[i] != '\n' {
 				continue
 			}
-			workCh <- b[last:i]
+			select {
+			case workCh <- b[last:i]:
+			case <-ctx.Done():
+				return
+			}
 			last = i + 1
 		}
-		close(workCh)
-		wg.Done()
 	}()
 
 	for i := 0; i < workers; i++ {
 		go func() {
+			defer wg.Done()
+
 			var sum int64
 			for line := range workCh { // Common mistake: for _, line := range <-workCh
-				num, err := ParseInt(line)
+				num, _, err := DefaultFormat.ParseInt(line)
 				if err != nil {
-					// TODO(bwplotka): Return err using other channel.
-					continue
+					// Line is a subslice of b, so the difference in capacity tells where it begins.
+					sendFirstErr(errCh, newParseError(b, cap(b)-cap(line), err))
+					cancel()
+					return
 				}
 				sum += num
 			}
 			atomic.AddInt64(&ret, sum)
-			wg.Done()
 		}()
 	}
 	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return 0, err
+	default:
+	}
 	return ret, nil
 }
 
-// Over inline budget, but for readability it's better. Consider splitting functions if needed to get it inlinded.
-//./sum_concurrent.go:11:6: cannot inline shardedRange: function too complex: cost 95 exceeds budget 80
-func shardedRange(routineNumber int, bytesPerWorker int, b []byte) (int, int) {
+// minShardSize is the minimum number of bytes per shard. Smaller shards are likely to have no full line,
+// so goroutine for them would be wasted.
+const minShardSize = 64
+
+// shardWorkers returns the number of workers to use for sharding size bytes, so each shard has at least
+// minShardSize bytes. It's never less than one.
+func shardWorkers(size int, workers int) int {
+	if workers > size/minShardSize {
+		workers = size / minShardSize
+	}
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// shardedRange returns the range of b the given worker out of workers should sum. Ranges of all workers are
+// adjacent, cover the whole b and have only full lines, no matter how long the lines are.
+// The last worker takes the remainder of the division, so it does not get lost for small inputs.
+func shardedRange(routineNumber int, workers int, b []byte) (int, int) {
+	bytesPerWorker := len(b) / workers
 	begin := routineNumber * bytesPerWorker
 	end := begin + bytesPerWorker
-	if end+bytesPerWorker > len(b) {
+	if routineNumber == workers-1 {
 		end = len(b)
 	}
 
 	// Find last newline before begin and add 1. If not found (-1), it means we
 	// are at the start. Otherwise, we start after last newline.
-	return bytes.LastIndex(b[:begin], []byte("\n")) + 1, end
+	// Do the same for the end, so shard has only full lines (the final line of b might be unterminated).
+	// Line longer than the shard makes it empty, the shard that begins with that line sums it.
+	begin = bytes.LastIndexByte(b[:begin], '\n') + 1
+	if end < len(b) {
+		end = bytes.LastIndexByte(b[:end], '\n') + 1
+	}
+	return begin, end
+}
+
+// errStopped is returned by workers which gave up, because the other worker failed.
+var errStopped = errors.New("stopped, other worker failed")
+
+type result struct {
+	sum int64
+	err error
+}
+
+// collect gathers results from all workers and returns the first error, if any worker failed.
+func collect(resultCh <-chan result, workers int) (ret int64, err error) {
+	for i := 0; i < workers; i++ {
+		r := <-resultCh
+		if r.err != nil && (err == nil || err == errStopped) {
+			err = r.err
+		}
+		ret += r.sum
+	}
+	if err != nil {
+		return 0, err
+	}
+	return ret, nil
+}
+
+// sumRange sums integers from full lines of b[begin:end] in the given format. It gives up when stop is set.
+func sumRange(b []byte, begin, end int, f Format, stop *atomic.Bool) (sum int64, _ error) {
+	last := begin
+	for ; begin < end; begin++ {
+		if b[begin] != '\n' {
+			continue
+		}
+		if stop.Load() {
+			return 0, errStopped
+		}
+		num, _, err := f.ParseInt(b[last:begin])
+		if err != nil {
+			stop.Store(true)
+			return 0, newParseError(b, last, err)
+		}
+		sum += num
+		last = begin + 1
+	}
+
+	if last < end {
+		// Final line without newline.
+		num, _, err := f.ParseInt(b[last:end])
+		if err != nil {
+			stop.Store(true)
+			return 0, newParseError(b, last, err)
+		}
+		sum += num
+	}
+	return sum, nil
 }
 
 // ConcurrentSum3 uses coordination free sharding to perform more efficient computation.
@@ -114,74 +242,123 @@ func ConcurrentSum3(fileName string, workers int) (ret int64, _ error) {
 	if err != nil {
 		return 0, err
 	}
+	return concurrentSumBytes(b, workers, DefaultFormat)
+}
+
+// concurrentSumBytes is the ConcurrentSum3 algorithm. Compressed input is summed in a single stream.
+func concurrentSumBytes(b []byte, workers int, f Format) (ret int64, err error) {
+	if DetectCompression(b) != NoCompression {
+		return sumCompressed(bytes.NewReader(b), f)
+	}
 
 	var (
-		bytesPerWorker = len(b) / workers
-		resultCh       = make(chan int64)
+		resultCh = make(chan result)
+		stop     atomic.Bool
 	)
+	workers = shardWorkers(len(b), workers)
 
 	for i := 0; i < workers; i++ {
 		go func(i int) {
 			// Coordination-free algorithm, which shards buffered file deterministically.
-			begin, end := shardedRange(i, bytesPerWorker, b)
+			begin, end := shardedRange(i, workers, b)
 
-			var sum int64
-			for last := begin; begin < end; begin++ {
-				if b[begin] != '\n' {
-					continue
-				}
-				num, err := ParseInt(b[last:begin])
-				if err != nil {
-					// TODO(bwplotka): Return err using other channel.
-					continue
-				}
-				sum += num
-				last = begin + 1
-			}
-			resultCh <- sum
+			sum, err := sumRange(b, begin, end, f, &stop)
+			resultCh <- result{sum: sum, err: err}
 		}(i)
 	}
 
-	for i := 0; i < workers; i++ {
-		ret += <-resultCh
-	}
+	ret, err = collect(resultCh, workers)
 	close(resultCh)
-	return ret, nil
+	return ret, err
 }
 
-func shardedRangeFromReaderAt(routineNumber int, bytesPerWorker int, size int, f io.ReaderAt) (int, int) {
-	begin := routineNumber * bytesPerWorker
-	end := begin + bytesPerWorker
-	if end+bytesPerWorker > size {
+// shardedRangeFromReaderAt is like shardedRange, but it reads only bytes needed to align the range from f.
+func shardedRangeFromReaderAt(routineNumber int, workers int, size int, f io.ReaderAt) (begin int, end int, err error) {
+	bytesPerWorker := size / workers
+	begin = routineNumber * bytesPerWorker
+	end = begin + bytesPerWorker
+	if routineNumber == workers-1 {
 		end = size
 	}
 
-	if begin == 0 {
-		return begin, end
+	// Align both begin and end to the beginning of line, so shard has only full lines.
+	if begin, err = lineBeginFromReaderAt(begin, f); err != nil {
+		return 0, 0, err
+	}
+	if end < size {
+		if end, err = lineBeginFromReaderAt(end, f); err != nil {
+			return 0, 0, err
+		}
+	}
+	return begin, end, nil
+}
+
+// lineBeginFromReaderAt returns the offset right after the last newline before pos or 0 if there is none.
+// It reads backwards in small chunks, so it works for lines of any length.
+func lineBeginFromReaderAt(pos int, f io.ReaderAt) (int, error) {
+	const chunkSize = 64
+	buf := make([]byte, chunkSize)
+
+	for pos > 0 {
+		n := chunkSize
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+
+		if _, err := f.ReadAt(buf[:n], int64(pos)); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + i + 1, nil
+		}
 	}
+	return 0, nil
+}
 
-	const maxNumSize = 10
-	buf := make([]byte, maxNumSize)
-	begin -= maxNumSize
+// stopped returns function that returns errStopped once stop is set.
+func stopped(stop *atomic.Bool) func() error {
+	return func() error {
+		if stop.Load() {
+			return errStopped
+		}
+		return nil
+	}
+}
 
-	if _, err := f.ReadAt(buf, int64(begin)); err != nil {
-		// TODO(bwplotka): Return err using other channel.
-		fmt.Println(err)
-		return 0, 0
+// shardParseErrorToFile updates ParseError (if any) returned for the shard starting at begin, so it points
+// to the position in the whole file.
+func shardParseErrorToFile(err error, f io.ReaderAt, begin int) {
+	var pErr *ParseError
+	if errors.As(err, &pErr) {
+		pErr.Offset += int64(begin)
+		// Best effort, offset is still helpful if we can't count lines.
+		pErr.Line, _ = lineAt(f, pErr.Offset)
 	}
+}
 
-	for i := maxNumSize; i > 0; i-- {
-		if buf[i-1] == '\n' {
-			begin += i
-			break
+// lineAt returns 1-based line number of the given offset by counting newlines before it.
+func lineAt(r io.ReaderAt, offset int64) (int, error) {
+	var (
+		line = 1
+		buf  = make([]byte, 8*1024)
+		sr   = io.NewSectionReader(r, 0, offset)
+	)
+	for {
+		n, err := sr.Read(buf)
+		line += bytes.Count(buf[:n], []byte("\n"))
+		if err == io.EOF {
+			return line, nil
+		}
+		if err != nil {
+			return 0, err
 		}
 	}
-	return begin, end
 }
 
 // ConcurrentSum4 is like ConcurrentSum3, but it reads file in sharded way too.
 // Read more in "Efficient Go"; Example 10-13.
-func ConcurrentSum4(fileName string, workers int) (ret int64, _ error) {
+func ConcurrentSum4(fileName string, workers int) (ret int64, err error) {
 	f, err := os.Open(fileName)
 	if err != nil {
 		return 0, err
@@ -193,34 +370,44 @@ func ConcurrentSum4(fileName string, workers int) (ret int64, _ error) {
 		return 0, err
 	}
 
+	// Compressed input can't be sharded, sum it in a single stream.
+	header := make([]byte, magicLen)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if DetectCompression(header[:n]) != NoCompression {
+		return sumCompressed(f, DefaultFormat)
+	}
+
 	var (
-		size           = int(s.Size())
-		bytesPerWorker = size / workers
-		resultCh       = make(chan int64)
+		size     = int(s.Size())
+		resultCh = make(chan result)
+		stop     atomic.Bool
 	)
-
-	if bytesPerWorker < 10 {
-		return 0, errors.New("can't have less bytes per goroutine than 10")
-	}
+	workers = shardWorkers(size, workers)
 
 	for i := 0; i < workers; i++ {
 		go func(i int) {
-			begin, end := shardedRangeFromReaderAt(i, bytesPerWorker, size, f)
+			begin, end, err := shardedRangeFromReaderAt(i, workers, size, f)
+			if err != nil {
+				stop.Store(true)
+				resultCh <- result{err: err}
+				return
+			}
 			r := io.NewSectionReader(f, int64(begin), int64(end-begin))
 
 			b := make([]byte, 8*1024)
-			sum, err := Sum6Reader(r, b)
+			sum, err := sumReader(r, b, DefaultFormat, stopped(&stop), nil)
 			if err != nil {
-				// TODO(bwplotka): Return err using other channel.
-				fmt.Println(err)
+				stop.Store(true)
+				shardParseErrorToFile(err, f, begin)
 			}
-			resultCh <- sum
+			resultCh <- result{sum: sum, err: err}
 		}(i)
 	}
 
-	for i := 0; i < workers; i++ {
-		ret += <-resultCh
-	}
+	ret, err = collect(resultCh, workers)
 	close(resultCh)
-	return ret, nil
+	return ret, err
 }
@@ -0,0 +1,73 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/efficientgo/examples/pkg/sum/sumconformance"
+)
+
+// conformingSums are all implementations of the sumconformance.SumFunc signature in this package.
+func conformingSums() map[string]sumconformance.SumFunc {
+	sums := map[string]sumconformance.SumFunc{
+		"Sum": Sum, "Sum2": Sum2, "Sum2_scanner": Sum2_scanner, "Sum3": Sum3, "Sum4": Sum4, "Sum4_atoi": Sum4_atoi,
+		"Sum4_swar": Sum4_swar, "Sum5": Sum5, "Sum5_line": Sum5_line, "Sum6": Sum6, "Sum7": Sum7, "SumMmap": SumMmap,
+		"SumChecked": SumChecked, "SumAuto": SumAuto, "ConcurrentSum1": ConcurrentSum1,
+		"SumWithFormat": func(fileName string) (int64, error) { return SumWithFormat(fileName, DefaultFormat) },
+	}
+	for name, f := range map[string]func(string, int) (int64, error){
+		"ConcurrentSum2": ConcurrentSum2, "ConcurrentSum3": ConcurrentSum3, "ConcurrentSum4": ConcurrentSum4,
+		"ConcurrentSumMmap": ConcurrentSumMmap, "ConcurrentSumChecked": ConcurrentSumChecked,
+	} {
+		for _, workers := range []int{1, 2, 7} {
+			f, workers := f, workers
+			sums[fmt.Sprintf("%v/%v", name, workers)] = func(fileName string) (int64, error) { return f(fileName, workers) }
+		}
+	}
+	return sums
+}
+
+// conformingReaders are all implementations of the sumconformance.ReaderFunc signature in this package.
+func conformingReaders() map[string]sumconformance.ReaderFunc {
+	withBuf := func(f func(io.Reader, []byte) (int64, error)) sumconformance.ReaderFunc {
+		return func(r io.Reader) (int64, error) { return f(r, make([]byte, 2*sumconformance.MaxLineLen)) }
+	}
+	return map[string]sumconformance.ReaderFunc{
+		"Sum6Reader":       withBuf(Sum6Reader),
+		"Sum6Reader_swar":  withBuf(Sum6Reader_swar),
+		"SumReaderChecked": withBuf(SumReaderChecked),
+		"SumReaderContext": withBuf(func(r io.Reader, buf []byte) (int64, error) {
+			return SumReaderContext(context.Background(), r, buf, nil)
+		}),
+		"SumCompressedReader": withBuf(func(r io.Reader, buf []byte) (int64, error) {
+			return SumCompressedReader(context.Background(), r, buf, nil)
+		}),
+		"SumReaderWithFormat": withBuf(func(r io.Reader, buf []byte) (int64, error) {
+			return SumReaderWithFormat(r, buf, DefaultFormat)
+		}),
+	}
+}
+
+func TestSum_Conformance(t *testing.T) {
+	for name, f := range conformingSums() {
+		t.Run(name, func(t *testing.T) { sumconformance.TestSum(t, f) })
+	}
+	for name, f := range conformingReaders() {
+		t.Run(name, func(t *testing.T) { sumconformance.TestReader(t, f) })
+	}
+}
+
+func FuzzSum4_Conformance(f *testing.F) { sumconformance.FuzzSum(f, Sum4) }
+
+func FuzzConcurrentSum4_Conformance(f *testing.F) {
+	sumconformance.FuzzSum(f, func(fileName string) (int64, error) { return ConcurrentSum4(fileName, 3) })
+}
+
+func FuzzSum6Reader_Conformance(f *testing.F) {
+	sumconformance.FuzzReader(f, func(r io.Reader) (int64, error) { return Sum6Reader(r, make([]byte, 2*sumconformance.MaxLineLen)) })
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"io"
+
+	"github.com/efficientgo/core/errors"
+)
+
+// Progress describes how much of the input streaming sum has processed so far.
+type Progress struct {
+	// BytesRead is the number of bytes read from the input.
+	BytesRead int64
+	// LinesParsed is the number of lines parsed so far (including lines skipped by the format).
+	LinesParsed int64
+}
+
+// SumReaderContext is like Sum6Reader, but it stops (returning ctx.Err()) when context is done. The context is
+// checked between buffer fills, so cancellation does not slow down parsing. If progress is not nil, it is
+// called after every buffer fill and can be used to report processing to logs or metrics.
+// Parse errors are returned as ParseError, with offset and line relative to the beginning of the reader.
+func SumReaderContext(ctx context.Context, r io.Reader, buf []byte, progress func(Progress)) (int64, error) {
+	return sumReader(r, buf, DefaultFormat, ctx.Err, progress)
+}
+
+// sumReader is the Sum6Reader algorithm which checks if it should give up before each buffer fill.
+func sumReader(r io.Reader, buf []byte, f Format, stopped func() error, progress func(Progress)) (ret int64, err error) {
+	var (
+		offset, n int
+		consumed  int64
+		p         Progress
+	)
+	for err != io.EOF {
+		if err := stopped(); err != nil {
+			return 0, err
+		}
+		if offset == len(buf) {
+			return 0, errors.Newf("line at byte offset %v is longer than the %v bytes buffer", consumed, len(buf))
+		}
+
+		n, err = r.Read(buf[offset:])
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		p.BytesRead += int64(n)
+		n += offset
+
+		var last int
+		for i := range buf[:n] {
+			if buf[i] != '\n' {
+				continue
+			}
+			num, _, err := f.ParseInt(buf[last:i])
+			if err != nil {
+				return 0, &ParseError{Offset: consumed + int64(last), Line: int(p.LinesParsed) + 1, Err: err}
+			}
+
+			ret += num
+			p.LinesParsed++
+			last = i + 1
+		}
+
+		if progress != nil {
+			progress(p)
+		}
+
+		consumed += int64(last)
+		offset = n - last
+		if offset > 0 {
+			_ = copy(buf, buf[last:n])
+		}
+	}
+
+	if offset > 0 {
+		// Final line without newline.
+		num, _, err := f.ParseInt(buf[:offset])
+		if err != nil {
+			return 0, &ParseError{Offset: consumed, Line: int(p.LinesParsed) + 1, Err: err}
+		}
+		ret += num
+		p.LinesParsed++
+		if progress != nil {
+			progress(p)
+		}
+	}
+	return ret, nil
+}
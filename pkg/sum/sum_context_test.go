@@ -0,0 +1,67 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+)
+
+func TestSumReaderContext(t *testing.T) {
+	input := bytes.Buffer{}
+	expectedSum, err := sumtestutil.CreateTestInputWithExpectedResult(&input, 1e4)
+	testutil.Ok(t, err)
+	size := int64(input.Len())
+
+	t.Run("progress", func(t *testing.T) {
+		var (
+			calls int
+			last  Progress
+		)
+		ret, err := SumReaderContext(context.Background(), bytes.NewReader(input.Bytes()), make([]byte, 1024), func(p Progress) {
+			testutil.Assert(t, p.BytesRead >= last.BytesRead, "bytes read should not decrease")
+			testutil.Assert(t, p.LinesParsed >= last.LinesParsed, "lines parsed should not decrease")
+			calls++
+			last = p
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+		testutil.Assert(t, calls > 1, "expected progress after every buffer fill, got %v calls", calls)
+		testutil.Equals(t, Progress{BytesRead: size, LinesParsed: 1e4}, last)
+	})
+	t.Run("no progress", func(t *testing.T) {
+		ret, err := SumReaderContext(context.Background(), bytes.NewReader(input.Bytes()), make([]byte, 1024), nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var bytesRead int64
+		_, err := SumReaderContext(ctx, bytes.NewReader(input.Bytes()), make([]byte, 1024), func(p Progress) {
+			bytesRead = p.BytesRead
+			cancel()
+		})
+		testutil.Assert(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+		testutil.Equals(t, int64(1024), bytesRead)
+	})
+	t.Run("invalid line", func(t *testing.T) {
+		_, err := SumReaderContext(context.Background(), strings.NewReader("1\n2\n1-2\n3\n"), make([]byte, 1024), nil)
+
+		var pErr *ParseError
+		testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+		testutil.Equals(t, int64(4), pErr.Offset)
+		testutil.Equals(t, 3, pErr.Line)
+	})
+	t.Run("line longer than buffer", func(t *testing.T) {
+		_, err := SumReaderContext(context.Background(), strings.NewReader("1\n123456789\n"), make([]byte, 4), nil)
+		testutil.NotOk(t, err)
+	})
+}
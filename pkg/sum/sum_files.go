@@ -0,0 +1,221 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/examples/pkg/profile/fd"
+)
+
+// OpenFunc opens the file for reading.
+type OpenFunc func(name string) (io.ReadCloser, error)
+
+// OpenTracked is OpenFunc which uses fd.Open, so files open by SumFiles show up in the fd.inuse profile.
+// Use it to find descriptor leaks.
+func OpenTracked(name string) (io.ReadCloser, error) {
+	f, err := fd.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// FileResult is the sum of a single file.
+type FileResult struct {
+	Path string
+	Sum  int64
+	// Err is the error of opening or summing the file. Sum is 0 if Err is not nil.
+	Err error
+}
+
+// FilesResult is the result of SumFiles.
+type FilesResult struct {
+	// Files are results of all files, in the order of the given paths. Files found by glob or in directories
+	// are in lexical order.
+	Files []FileResult
+	// Sum is the sum of all files summed successfully.
+	Sum int64
+	// Failed is the number of files with an error.
+	Failed int
+}
+
+// Err returns nil if all files were summed successfully, otherwise the error of the first failed file.
+func (r *FilesResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	for _, f := range r.Files {
+		if f.Err != nil {
+			return errors.Wrapf(f.Err, "%v of %v files failed, first %v", r.Failed, len(r.Files), f.Path)
+		}
+	}
+	return nil
+}
+
+// SumFiles sums integers from all files in paths, which can be files, directories (walked recursively, only
+// regular files are summed) or glob patterns (see filepath.Match). Files are summed concurrently, with at most
+// maxOpenFiles files open at the same time (GOMAXPROCS if not positive). Each file is summed in a single stream, so
+// it's efficient for many small files; use ConcurrentSum4 or SumPool for a few big ones. Compressed files (see
+// DetectCompression) are decompressed.
+//
+// Files are open with open, os.Open if nil (see OpenTracked). Each file is summed once, even if it is matched by
+// multiple paths. Per file errors (including missing files) are reported in the result, so the returned error is
+// only about invalid pattern or context being done.
+func SumFiles(ctx context.Context, paths []string, maxOpenFiles int, open OpenFunc) (*FilesResult, error) {
+	if maxOpenFiles <= 0 {
+		maxOpenFiles = runtime.GOMAXPROCS(0)
+	}
+	if open == nil {
+		open = func(name string) (io.ReadCloser, error) { return os.Open(name) }
+	}
+
+	files, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res    = &FilesResult{Files: files}
+		fileCh = make(chan int)
+		wg     sync.WaitGroup
+	)
+	if maxOpenFiles > len(files) {
+		maxOpenFiles = len(files)
+	}
+	wg.Add(maxOpenFiles)
+	for i := 0; i < maxOpenFiles; i++ {
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, 8*1024)
+			for i := range fileCh {
+				// Each worker writes to different element, so no locking is needed.
+				res.Files[i].Sum, res.Files[i].Err = sumFile(ctx, open, res.Files[i].Path, buf)
+			}
+		}()
+	}
+
+	for i := range files {
+		if files[i].Err != nil {
+			continue
+		}
+		select {
+		case fileCh <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(fileCh)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range res.Files {
+		if f.Err != nil {
+			res.Failed++
+			continue
+		}
+		res.Sum += f.Sum
+	}
+	return res, nil
+}
+
+// SumDir is like SumFiles, but for all regular files in the directory tree.
+func SumDir(ctx context.Context, dir string, maxOpenFiles int, open OpenFunc) (*FilesResult, error) {
+	return SumFiles(ctx, []string{dir}, maxOpenFiles, open)
+}
+
+func sumFile(ctx context.Context, open OpenFunc, fileName string, buf []byte) (_ int64, err error) {
+	f, err := open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, f.Close, "close file")
+
+	dr, _, err := Decompress(f)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, dr.Close, "close decompressor")
+
+	return sumReader(dr, buf, DefaultFormat, ctx.Err, nil)
+}
+
+// expandPaths returns results with paths of all files to sum. Paths which can't be expanded (e.g. missing
+// files) are returned with an error.
+func expandPaths(paths []string) ([]FileResult, error) {
+	var (
+		files []FileResult
+		seen  = map[string]struct{}{}
+	)
+	add := func(p string, err error) {
+		p = filepath.Clean(p)
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		files = append(files, FileResult{Path: p, Err: err})
+	}
+
+	for _, p := range paths {
+		matches := []string{p}
+		if hasGlobMeta(p) {
+			var err error
+			if matches, err = filepath.Glob(p); err != nil {
+				return nil, errors.Wrapf(err, "glob %v", p)
+			}
+			if len(matches) == 0 {
+				add(p, errors.Newf("no files match %v", p))
+				continue
+			}
+		}
+
+		for _, m := range matches {
+			fi, err := os.Stat(m)
+			if err != nil {
+				add(m, err)
+				continue
+			}
+			if !fi.IsDir() {
+				add(m, nil)
+				continue
+			}
+			// WalkDir is in lexical order, so results are deterministic.
+			_ = filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					// Unreadable directory, report it and continue with the others.
+					add(path, err)
+					return nil
+				}
+				if d.Type().IsRegular() {
+					add(path, nil)
+				}
+				return nil
+			})
+		}
+	}
+	return files, nil
+}
+
+func hasGlobMeta(path string) bool {
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync/atomic"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+func createFiles(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		testutil.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), os.ModePerm))
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, name), content, os.ModePerm))
+	}
+	return dir
+}
+
+func TestSumFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := createFiles(t, map[string][]byte{
+		"a.txt":          []byte("1\n2\n3\n"),
+		"b.txt":          []byte("10"),
+		"empty.txt":      {},
+		"sub/c.txt":      []byte("-100\n"),
+		"sub/d.txt.gz":   compress(t, Gzip, []byte("1000\n2000\n")),
+		"sub/sub/e.txt":  []byte("10000\n"),
+		"sub/invalid.md": []byte("1\n12a4\n"),
+	})
+	path := func(p string) string { return filepath.Join(dir, p) }
+
+	t.Run("dir", func(t *testing.T) {
+		res, err := SumDir(ctx, dir, 2, nil)
+		testutil.Ok(t, err)
+
+		var paths []string
+		for _, f := range res.Files {
+			paths = append(paths, f.Path)
+		}
+		testutil.Equals(t, []string{
+			path("a.txt"), path("b.txt"), path("empty.txt"),
+			path("sub/c.txt"), path("sub/d.txt.gz"), path("sub/invalid.md"), path("sub/sub/e.txt"),
+		}, paths)
+		testutil.Equals(t, int64(6+10+0-100+3000+10000), res.Sum)
+		testutil.Equals(t, 1, res.Failed)
+		testutil.Equals(t, FileResult{Path: path("sub/c.txt"), Sum: -100}, res.Files[3])
+
+		testutil.NotOk(t, res.Files[5].Err)
+		var pErr *ParseError
+		testutil.Assert(t, errors.As(res.Err(), &pErr), "expected ParseError, got %v", res.Err())
+		testutil.Equals(t, 2, pErr.Line)
+	})
+	t.Run("files and globs", func(t *testing.T) {
+		res, err := SumFiles(ctx, []string{path("sub/c.txt"), path("*.txt"), path("sub/c.txt"), path("missing.txt"), path("*.csv")}, 0, nil)
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, 6, len(res.Files))
+		testutil.Equals(t, path("sub/c.txt"), res.Files[0].Path)
+		testutil.Equals(t, path("a.txt"), res.Files[1].Path)
+		testutil.Equals(t, path("missing.txt"), res.Files[4].Path)
+		testutil.Assert(t, errors.Is(res.Files[4].Err, os.ErrNotExist), "expected missing file, got %v", res.Files[4].Err)
+		testutil.Equals(t, path("*.csv"), res.Files[5].Path)
+		testutil.NotOk(t, res.Files[5].Err)
+
+		testutil.Equals(t, int64(6+10-100), res.Sum)
+		testutil.Equals(t, 2, res.Failed)
+	})
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := SumFiles(ctx, []string{path("[")}, 0, nil)
+		testutil.NotOk(t, err)
+	})
+	t.Run("all ok", func(t *testing.T) {
+		res, err := SumFiles(ctx, []string{path("a.txt")}, 0, nil)
+		testutil.Ok(t, err)
+		testutil.Ok(t, res.Err())
+	})
+	t.Run("canceled", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := SumDir(cctx, dir, 1, nil)
+		testutil.Equals(t, context.Canceled, err)
+	})
+	t.Run("bounded open files", func(t *testing.T) {
+		var open, maxOpen atomic.Int64
+		res, err := SumDir(ctx, dir, 2, func(name string) (io.ReadCloser, error) {
+			n := open.Add(1)
+			for {
+				if m := maxOpen.Load(); n <= m || maxOpen.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				open.Add(-1)
+				return nil, err
+			}
+			return closerFunc{ReadCloser: f, close: func() { open.Add(-1) }}, nil
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 7, len(res.Files))
+		testutil.Equals(t, int64(0), open.Load())
+		testutil.Assert(t, maxOpen.Load() <= 2, "max open files %v", maxOpen.Load())
+	})
+	t.Run("tracked", func(t *testing.T) {
+		res, err := SumDir(ctx, dir, 3, OpenTracked)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, res.Failed)
+		// No leaked descriptors.
+		testutil.Equals(t, 0, pprof.Lookup("fd.inuse").Count())
+	})
+}
+
+type closerFunc struct {
+	io.ReadCloser
+	close func()
+}
+
+func (c closerFunc) Close() error {
+	c.close()
+	return c.ReadCloser.Close()
+}
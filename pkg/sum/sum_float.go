@@ -0,0 +1,469 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/efficientgo/core/errors"
+)
+
+// pow10 are powers of 10 that are exactly representable in float64.
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// ParseFloat parses decimal floating point number, e.g. "12.50", "-.5" or "-3e4".
+// Most numbers are parsed with the exact fast path (mantissa and power of ten both exactly representable
+// in float64), the rest falls back to strconv.ParseFloat. Hex floats, "Inf" and "NaN" are not accepted.
+func ParseFloat(input []byte) (float64, error) {
+	var (
+		i        int
+		neg      bool
+		mantissa uint64
+		digits   int // Significant digits in mantissa.
+		exp      int
+		sawDigit bool
+		overflow bool // Mantissa has more digits than we can track.
+	)
+
+	if i < len(input) && (input[i] == '-' || input[i] == '+') {
+		neg = input[i] == '-'
+		i++
+	}
+	for ; i < len(input) && input[i] >= '0' && input[i] <= '9'; i++ {
+		sawDigit = true
+		mantissa, digits, overflow = addDigit(mantissa, digits, overflow, input[i])
+		if overflow {
+			exp++
+		}
+	}
+	if i < len(input) && input[i] == '.' {
+		for i++; i < len(input) && input[i] >= '0' && input[i] <= '9'; i++ {
+			sawDigit = true
+			mantissa, digits, overflow = addDigit(mantissa, digits, overflow, input[i])
+			if !overflow {
+				exp--
+			}
+		}
+	}
+	if !sawDigit {
+		return 0, errors.Newf("not a valid float: %v", input)
+	}
+
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		i++
+		expNeg := false
+		if i < len(input) && (input[i] == '-' || input[i] == '+') {
+			expNeg = input[i] == '-'
+			i++
+		}
+		if i == len(input) {
+			return 0, errors.Newf("not a valid float: %v", input)
+		}
+		e := 0
+		for ; i < len(input) && input[i] >= '0' && input[i] <= '9'; i++ {
+			if e < 1e5 {
+				e = e*10 + int(input[i]-'0')
+			}
+		}
+		if expNeg {
+			e = -e
+		}
+		exp += e
+	}
+	if i != len(input) {
+		return 0, errors.Newf("not a valid float: %v", input)
+	}
+
+	if !overflow && mantissa < 1<<53 && exp >= -22 && exp <= 22 {
+		f := float64(mantissa)
+		if exp < 0 {
+			f /= pow10[-exp]
+		} else {
+			f *= pow10[exp]
+		}
+		if neg {
+			f = -f
+		}
+		return f, nil
+	}
+
+	// Slow path, syntax was validated already.
+	return strconv.ParseFloat(zeroCopyToString(input), 64)
+}
+
+func addDigit(mantissa uint64, digits int, overflow bool, d byte) (uint64, int, bool) {
+	if overflow || digits == 19 {
+		return mantissa, digits, true
+	}
+	if mantissa == 0 && d == '0' {
+		// Leading zeros are not significant.
+		return 0, digits, false
+	}
+	return mantissa*10 + uint64(d-'0'), digits + 1, false
+}
+
+// ParseDecimal parses decimal number into fixed-point integer with the given number of fractional digits (scale),
+// e.g. ParseDecimal("12.5", 2) returns 1250. More fractional digits than scale is an error, so no precision
+// is lost silently. Exponents are not accepted. Negative scale is an error.
+func ParseDecimal(input []byte, scale int) (n int64, _ error) {
+	if err := validateScale(scale); err != nil {
+		return 0, err
+	}
+
+	var (
+		i        int
+		neg      bool
+		u        uint64
+		sawDigit bool
+		frac     = -1 // Number of fractional digits seen, -1 if no '.'.
+	)
+	const limit = uint64(1 << 63)
+
+	if i < len(input) && (input[i] == '-' || input[i] == '+') {
+		neg = input[i] == '-'
+		i++
+	}
+	for ; i < len(input); i++ {
+		c := input[i]
+		if c == '.' && frac == -1 {
+			frac = 0
+			continue
+		}
+		if c < '0' || c > '9' {
+			return 0, errors.Newf("not a valid decimal: %v", input)
+		}
+		sawDigit = true
+		if frac >= 0 {
+			if frac == scale {
+				return 0, errors.Newf("decimal %s has more than %v fractional digits", input, scale)
+			}
+			frac++
+		}
+		if u > limit/10 {
+			return 0, errors.Wrapf(ErrOverflow, "decimal %s", input)
+		}
+		u = u*10 + uint64(c-'0')
+		if u > limit {
+			return 0, errors.Wrapf(ErrOverflow, "decimal %s", input)
+		}
+	}
+	if !sawDigit {
+		return 0, errors.Newf("not a valid decimal: %v", input)
+	}
+
+	// Pad missing fractional digits.
+	if frac < 0 {
+		frac = 0
+	}
+	for ; frac < scale; frac++ {
+		if u > limit/10 {
+			return 0, errors.Wrapf(ErrOverflow, "decimal %s", input)
+		}
+		u *= 10
+	}
+
+	if neg {
+		return -int64(u), nil // For u = 2^63 it wraps exactly to the minimum int64.
+	}
+	if u == limit {
+		return 0, errors.Wrapf(ErrOverflow, "decimal %s", input)
+	}
+	return int64(u), nil
+}
+
+// neumaier is a compensated (Kahan-Babuska-Neumaier) summation accumulator. It keeps track of the low-order bits lost
+// by each addition, so summing millions of floats does not accumulate rounding errors.
+type neumaier struct {
+	sum, c float64
+}
+
+func (n *neumaier) add(v float64) {
+	t := n.sum + v
+	if math.Abs(n.sum) >= math.Abs(v) {
+		n.c += (n.sum - t) + v
+	} else {
+		n.c += (v - t) + n.sum
+	}
+	n.sum = t
+}
+
+func (n *neumaier) merge(o neumaier) {
+	n.add(o.sum)
+	n.add(o.c)
+}
+
+func (n neumaier) result() float64 { return n.sum + n.c }
+
+// forEachToken calls fn with each number token from full lines of b[begin:end] in the DefaultFormat.
+// It gives up when stop is set.
+func forEachToken(b []byte, begin, end int, stop *atomic.Bool, fn func(tok []byte) error) error {
+	last := begin
+	for ; begin <= end; begin++ {
+		if begin < end && b[begin] != '\n' {
+			continue
+		}
+		if begin == end && last == end {
+			// No final, unterminated line.
+			break
+		}
+		if stop.Load() {
+			return errStopped
+		}
+
+		tok, ok, err := DefaultFormat.Token(b[last:begin])
+		if err == nil && ok {
+			err = fn(tok)
+		}
+		if err != nil {
+			stop.Store(true)
+			return newParseError(b, last, err)
+		}
+		last = begin + 1
+	}
+	return nil
+}
+
+// forEachTokenReader is like forEachToken, but for the reader.
+func forEachTokenReader(r io.Reader, buf []byte, fn func(tok []byte) error) (err error) {
+	var (
+		offset, n int
+		consumed  int64
+		lines     int
+	)
+
+	callFn := func(line []byte) error {
+		tok, ok, err := DefaultFormat.Token(line)
+		if err == nil && ok {
+			err = fn(tok)
+		}
+		lines++
+		return err
+	}
+
+	for err != io.EOF {
+		if offset == len(buf) {
+			return errors.Newf("line at byte offset %v is longer than the %v bytes buffer", consumed, len(buf))
+		}
+
+		n, err = r.Read(buf[offset:])
+		if err != nil && err != io.EOF {
+			return err
+		}
+		n += offset
+
+		var last int
+		for i := range buf[:n] {
+			if buf[i] != '\n' {
+				continue
+			}
+			if err := callFn(buf[last:i]); err != nil {
+				return &ParseError{Offset: consumed + int64(last), Line: lines, Err: err}
+			}
+			last = i + 1
+		}
+
+		consumed += int64(last)
+		offset = n - last
+		if offset > 0 {
+			_ = copy(buf, buf[last:n])
+		}
+	}
+
+	if offset > 0 {
+		// Final line without newline.
+		if err := callFn(buf[:offset]); err != nil {
+			return &ParseError{Offset: consumed, Line: lines, Err: err}
+		}
+	}
+	return nil
+}
+
+// SumFloat is like Sum4, but for floating point numbers (see ParseFloat). It uses compensated summation, so
+// the result is accurate even for many numbers of different magnitude.
+func SumFloat(fileName string) (float64, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		acc  neumaier
+		stop atomic.Bool
+	)
+	if err := forEachToken(b, 0, len(b), &stop, func(tok []byte) error {
+		f, err := ParseFloat(tok)
+		acc.add(f)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return acc.result(), nil
+}
+
+// SumFloatReader is like Sum6Reader, but for floating point numbers. See SumFloat.
+func SumFloatReader(r io.Reader, buf []byte) (float64, error) {
+	var acc neumaier
+	if err := forEachTokenReader(r, buf, func(tok []byte) error {
+		f, err := ParseFloat(tok)
+		acc.add(f)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return acc.result(), nil
+}
+
+// ConcurrentSumFloat is like ConcurrentSum3, but for floating point numbers. See SumFloat.
+func ConcurrentSumFloat(fileName string, workers int) (float64, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		acc neumaier
+		err error
+	}
+
+	var (
+		resultCh = make(chan result)
+		stop     atomic.Bool
+	)
+	workers = shardWorkers(len(b), workers)
+
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			begin, end := shardedRange(i, workers, b)
+
+			var acc neumaier
+			err := forEachToken(b, begin, end, &stop, func(tok []byte) error {
+				f, err := ParseFloat(tok)
+				acc.add(f)
+				return err
+			})
+			resultCh <- result{acc: acc, err: err}
+		}(i)
+	}
+
+	var acc neumaier
+	for i := 0; i < workers; i++ {
+		r := <-resultCh
+		if r.err != nil && (err == nil || err == errStopped) {
+			err = r.err
+		}
+		acc.merge(r.acc)
+	}
+	close(resultCh)
+	if err != nil {
+		return 0, err
+	}
+	return acc.result(), nil
+}
+
+// validateScale returns an error if the fixed-point scale is negative.
+func validateScale(scale int) error {
+	if scale < 0 {
+		return errors.Newf("scale has to be non-negative, got %v", scale)
+	}
+	return nil
+}
+
+// SumDecimal is like Sum4, but for decimal numbers with up to scale fractional digits (see ParseDecimal).
+// The sum is returned as fixed-point integer, e.g. for scale 2, "12.50" and "0.5" sum to 1300.
+// It's exact and detects overflows like SumChecked, which makes it suitable for monetary values.
+func SumDecimal(fileName string, scale int) (int64, error) {
+	if err := validateScale(scale); err != nil {
+		return 0, err
+	}
+
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		acc  int128
+		stop atomic.Bool
+	)
+	if err := forEachToken(b, 0, len(b), &stop, func(tok []byte) error {
+		d, err := ParseDecimal(tok, scale)
+		acc.add(d)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return acc.int64()
+}
+
+// SumDecimalReader is like Sum6Reader, but for decimal numbers. See SumDecimal.
+func SumDecimalReader(r io.Reader, buf []byte, scale int) (int64, error) {
+	if err := validateScale(scale); err != nil {
+		return 0, err
+	}
+
+	var acc int128
+	if err := forEachTokenReader(r, buf, func(tok []byte) error {
+		d, err := ParseDecimal(tok, scale)
+		acc.add(d)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return acc.int64()
+}
+
+// ConcurrentSumDecimal is like ConcurrentSum3, but for decimal numbers. See SumDecimal.
+func ConcurrentSumDecimal(fileName string, workers int, scale int) (int64, error) {
+	if err := validateScale(scale); err != nil {
+		return 0, err
+	}
+
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		acc int128
+		err error
+	}
+
+	var (
+		resultCh = make(chan result)
+		stop     atomic.Bool
+	)
+	workers = shardWorkers(len(b), workers)
+
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			begin, end := shardedRange(i, workers, b)
+
+			var acc int128
+			err := forEachToken(b, begin, end, &stop, func(tok []byte) error {
+				d, err := ParseDecimal(tok, scale)
+				acc.add(d)
+				return err
+			})
+			resultCh <- result{acc: acc, err: err}
+		}(i)
+	}
+
+	var acc int128
+	for i := 0; i < workers; i++ {
+		r := <-resultCh
+		if r.err != nil && (err == nil || err == errStopped) {
+			err = r.err
+		}
+		acc.merge(r.acc)
+	}
+	close(resultCh)
+	if err != nil {
+		return 0, err
+	}
+	return acc.int64()
+}
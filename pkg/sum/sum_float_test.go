@@ -0,0 +1,248 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestParseFloat(t *testing.T) {
+	for _, in := range []string{
+		"0", "-0", "1", "-1", "+1", "12.50", "-3e4", "3E-4", ".5", "-.5", "5.", "0.1", "0.3",
+		"123456789012345678", "1234567890123456789012345", "0.000000000000000000000000001",
+		"1.7976931348623157e308", "4.9e-324", "1e23", "9007199254740993", "00000000000000000000001.5",
+	} {
+		t.Run(in, func(t *testing.T) {
+			exp, err := strconv.ParseFloat(in, 64)
+			testutil.Ok(t, err)
+
+			got, err := ParseFloat([]byte(in))
+			testutil.Ok(t, err)
+			testutil.Equals(t, exp, got)
+		})
+	}
+
+	for _, in := range []string{"", "-", "+", ".", "-.", "e4", "1e", "1e+", "1.2.3", "1-2", "12a", "Inf", "NaN", "0x10", " 1"} {
+		t.Run(in, func(t *testing.T) {
+			_, err := ParseFloat([]byte(in))
+			testutil.NotOk(t, err)
+		})
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, tcase := range []struct {
+		in       string
+		scale    int
+		expected int64
+	}{
+		{in: "12.50", scale: 2, expected: 1250},
+		{in: "12.5", scale: 2, expected: 1250},
+		{in: "12", scale: 2, expected: 1200},
+		{in: "-0.01", scale: 2, expected: -1},
+		{in: "+.5", scale: 1, expected: 5},
+		{in: "7.", scale: 0, expected: 7},
+		{in: "-9223372036854775808", scale: 0, expected: math.MinInt64},
+		{in: "-922337203685477580.8", scale: 1, expected: math.MinInt64},
+		{in: "9223372036854775807", scale: 0, expected: math.MaxInt64},
+	} {
+		t.Run(tcase.in, func(t *testing.T) {
+			got, err := ParseDecimal([]byte(tcase.in), tcase.scale)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, got)
+		})
+	}
+
+	for _, tcase := range []struct {
+		in       string
+		scale    int
+		overflow bool
+	}{
+		{in: ""}, {in: "-"}, {in: "."}, {in: "1.2.3", scale: 2}, {in: "1e3", scale: 2}, {in: "12a", scale: 2},
+		{in: "1.234", scale: 2},
+		{in: "12", scale: -1}, {in: "0", scale: -2},
+		{in: "9223372036854775808", overflow: true},
+		{in: "92233720368547758.08", scale: 3, overflow: true},
+		{in: "99999999999999999999999", overflow: true},
+	} {
+		t.Run(tcase.in, func(t *testing.T) {
+			_, err := ParseDecimal([]byte(tcase.in), tcase.scale)
+			testutil.NotOk(t, err)
+			testutil.Equals(t, tcase.overflow, errors.Is(err, ErrOverflow))
+		})
+	}
+}
+
+func TestNeumaier(t *testing.T) {
+	// Naive summation returns 0 here.
+	var n neumaier
+	for _, v := range []float64{1, 1e100, 1, -1e100} {
+		n.add(v)
+	}
+	testutil.Equals(t, 2.0, n.result())
+
+	// Merging partial sums is as accurate as a single pass.
+	var a, b neumaier
+	a.add(1)
+	a.add(1e100)
+	b.add(1)
+	b.add(-1e100)
+	a.merge(b)
+	testutil.Equals(t, 2.0, a.result())
+}
+
+func TestSumFloat(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+
+	// Numbers of very different magnitude, naive summation loses the small ones.
+	buf := bytes.Buffer{}
+	exact := new(big.Float).SetPrec(2048)
+	naive := 0.0
+	for _, v := range []string{"0.1", "-3e-1", "", "1e17", "0.2", "-1e17", "3.3"} {
+		for j := 0; j < 1e4; j++ {
+			buf.WriteString(v + "\n")
+			if v == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			testutil.Ok(t, err)
+			naive += f
+			if j == 0 {
+				exact.Add(exact, new(big.Float).Mul(big.NewFloat(f), big.NewFloat(1e4)))
+			}
+		}
+	}
+	buf.WriteString("12.50") // No trailing newline.
+	exact.Add(exact, big.NewFloat(12.5))
+	testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+	expected, _ := exact.Float64()
+	testutil.Assert(t, math.Abs(expected-naive) > 1, "naive summation should be off, got %v, expected %v", naive, expected)
+
+	// Compensated summation is not exact, but its error does not grow with the number of lines like naive one.
+	assertClose := func(t *testing.T, ret float64) {
+		t.Helper()
+		testutil.Assert(t, math.Abs(expected-ret) < 1e-6, "expected %v, got %v", expected, ret)
+	}
+
+	ret, err := SumFloat(testFile)
+	testutil.Ok(t, err)
+	assertClose(t, ret)
+
+	ret, err = SumFloatReader(bytes.NewReader(buf.Bytes()), make([]byte, 16))
+	testutil.Ok(t, err)
+	assertClose(t, ret)
+
+	for _, workers := range []int{1, 4, 11} {
+		ret, err = ConcurrentSumFloat(testFile, workers)
+		testutil.Ok(t, err)
+		assertClose(t, ret)
+	}
+}
+
+func TestSumDecimal(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+
+	buf := bytes.Buffer{}
+	for i := 0; i < 1e4; i++ {
+		buf.WriteString("0.10\n-3\n\n12.5\n")
+	}
+	buf.WriteString("0.01") // No trailing newline.
+	testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+	const expected = int64(1e4*(10-300+1250) + 1)
+	ret, err := SumDecimal(testFile, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, ret)
+
+	ret, err = SumDecimalReader(bytes.NewReader(buf.Bytes()), make([]byte, 16), 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, ret)
+
+	for _, workers := range []int{1, 4, 11} {
+		ret, err = ConcurrentSumDecimal(testFile, workers, 2)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, ret)
+	}
+
+	t.Run("negative scale", func(t *testing.T) {
+		_, err := SumDecimal(testFile, -1)
+		testutil.NotOk(t, err)
+		_, err = SumDecimalReader(bytes.NewReader(nil), make([]byte, 16), -1)
+		testutil.NotOk(t, err)
+		_, err = ConcurrentSumDecimal(testFile, 2, -1)
+		testutil.NotOk(t, err)
+	})
+	t.Run("overflow", func(t *testing.T) {
+		in := strings.Repeat("92233720368547758.07\n", 2)
+		testutil.Ok(t, os.WriteFile(testFile, []byte(in), os.ModePerm))
+
+		_, err := SumDecimal(testFile, 2)
+		testutil.Assert(t, errors.Is(err, ErrOverflow), "expected overflow, got %v", err)
+	})
+}
+
+func TestSumFloat_InvalidInput(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+
+	in := strings.Repeat("1.5\n", 1e3)
+	expectedOffset := int64(len(in))
+	in += "1.5.1\n" + strings.Repeat("1.5\n", 1e3)
+	testutil.Ok(t, os.WriteFile(testFile, []byte(in), os.ModePerm))
+
+	for _, tcase := range []struct {
+		name string
+		f    func() error
+	}{
+		{name: "SumFloat", f: func() error { _, err := SumFloat(testFile); return err }},
+		{name: "SumFloatReader", f: func() error {
+			_, err := SumFloatReader(strings.NewReader(in), make([]byte, 64))
+			return err
+		}},
+		{name: "ConcurrentSumFloat", f: func() error { _, err := ConcurrentSumFloat(testFile, 4); return err }},
+		{name: "SumDecimal", f: func() error { _, err := SumDecimal(testFile, 2); return err }},
+		{name: "SumDecimalReader", f: func() error {
+			_, err := SumDecimalReader(strings.NewReader(in), make([]byte, 64), 2)
+			return err
+		}},
+		{name: "ConcurrentSumDecimal", f: func() error { _, err := ConcurrentSumDecimal(testFile, 4, 2); return err }},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			err := tcase.f()
+			testutil.NotOk(t, err)
+
+			var pErr *ParseError
+			testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+			testutil.Equals(t, expectedOffset, pErr.Offset)
+			testutil.Equals(t, int(1e3)+1, pErr.Line)
+		})
+	}
+}
+
+func BenchmarkParseFloat(b *testing.B) {
+	input := []byte("-1234.5678")
+
+	b.Run("ParseFloat", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = ParseFloat(input)
+		}
+	})
+	b.Run("strconv", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = strconv.ParseFloat(zeroCopyToString(input), 64)
+		}
+	})
+}
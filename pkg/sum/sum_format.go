@@ -0,0 +1,129 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/efficientgo/core/errors"
+)
+
+// Format describes what the input is allowed to contain on top of the canonical format: one base-10 integer per
+// line, each line terminated with '\n'. Final line without '\n' is always accepted.
+// Formats can be combined, e.g. AllowCRLF|AllowSpaces.
+type Format uint8
+
+const (
+	// AllowBlankLines skips empty lines (or lines with only spaces if AllowSpaces is set too).
+	AllowBlankLines Format = 1 << iota
+	// AllowCRLF accepts "\r\n" line terminators.
+	AllowCRLF
+	// AllowSpaces trims spaces and tabs around the number.
+	AllowSpaces
+	// AllowPlusSign accepts explicit plus sign, e.g. "+12".
+	AllowPlusSign
+	// AllowComments skips lines starting with '#' (after spaces, if AllowSpaces is set too).
+	AllowComments
+
+	// DefaultFormat is the format accepted by all SumN and ConcurrentSumN functions.
+	DefaultFormat = AllowBlankLines
+	// LenientFormat accepts everything the tokenizer knows about.
+	LenientFormat = AllowBlankLines | AllowCRLF | AllowSpaces | AllowPlusSign | AllowComments
+)
+
+// Token returns the number token from the single line (without '\n'). It returns false if the line
+// has to be skipped (e.g. blank line or comment) and error if the line is not allowed by the format.
+// Token does not validate digits, this is the job of the parser (e.g. strconv.ParseInt).
+func (f Format) Token(line []byte) (_ []byte, ok bool, _ error) {
+	if f == DefaultFormat && len(line) > 0 && line[0] > '+' {
+		return line, true, nil
+	}
+	return f.token(line)
+}
+
+// ParseInt is like Token followed by ParseInt, but in a single call, which is easier to use in loops.
+func (f Format) ParseInt(line []byte) (n int64, ok bool, err error) {
+	// Digits and '-' are ordered after '+', so a single comparison is enough to take the fast path.
+	if f != DefaultFormat || len(line) == 0 || line[0] <= '+' {
+		if line, ok, err = f.token(line); err != nil || !ok {
+			return 0, ok, err
+		}
+	}
+	n, err = ParseInt(line)
+	return n, err == nil, err
+}
+
+func (f Format) token(line []byte) (_ []byte, ok bool, _ error) {
+	if f&AllowCRLF != 0 && len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	if f&AllowSpaces != 0 {
+		line = trimSpaces(line)
+	}
+
+	if len(line) == 0 {
+		if f&AllowBlankLines == 0 {
+			return nil, false, errors.New("unexpected blank line")
+		}
+		return nil, false, nil
+	}
+	if f&AllowComments != 0 && line[0] == '#' {
+		return nil, false, nil
+	}
+
+	if line[0] == '+' {
+		// Sign followed by another sign, e.g. "+-1" is never valid.
+		if f&AllowPlusSign == 0 || len(line) == 1 || line[1] == '-' || line[1] == '+' {
+			return nil, false, errors.Newf("not a valid integer: %v", line)
+		}
+		line = line[1:]
+	}
+	return line, true, nil
+}
+
+func trimSpaces(b []byte) []byte {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// terminated returns b with the final line terminated with '\n', so loops looking for '\n' don't need to handle
+// the final, unterminated line separately. os.ReadFile leaves spare capacity, so in practice it does not copy.
+func terminated(b []byte) []byte {
+	if len(b) == 0 || b[len(b)-1] == '\n' {
+		return b
+	}
+	return append(b, '\n')
+}
+
+// SumWithFormat is like Sum4, but it accepts input in the given format.
+func SumWithFormat(fileName string, f Format) (int64, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	var stop atomic.Bool
+	return sumRange(b, 0, len(b), f, &stop)
+}
+
+// SumReaderWithFormat is like Sum6Reader, but it accepts input in the given format.
+func SumReaderWithFormat(r io.Reader, buf []byte, f Format) (int64, error) {
+	return sumReader(r, buf, f, func() error { return nil }, nil)
+}
+
+// ConcurrentSumWithFormat is like ConcurrentSum3, but it accepts input in the given format.
+func ConcurrentSumWithFormat(fileName string, workers int, f Format) (int64, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	return concurrentSumBytes(b, workers, f)
+}
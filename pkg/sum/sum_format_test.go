@@ -0,0 +1,134 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestFormat_Token(t *testing.T) {
+	for _, tcase := range []struct {
+		line   string
+		format Format
+
+		expected    string
+		expectedOK  bool
+		expectedErr bool
+	}{
+		{line: "123", format: DefaultFormat, expected: "123", expectedOK: true},
+		{line: "-123", format: DefaultFormat, expected: "-123", expectedOK: true},
+		{line: "", format: DefaultFormat},
+		{line: "", format: 0, expectedErr: true},
+		{line: "+123", format: DefaultFormat, expectedErr: true},
+		{line: "+123", format: AllowPlusSign, expected: "123", expectedOK: true},
+		{line: "+-123", format: AllowPlusSign, expectedErr: true},
+		{line: "+", format: AllowPlusSign, expectedErr: true},
+		{line: "123\r", format: DefaultFormat, expected: "123\r", expectedOK: true}, // Rejected by parser.
+		{line: "123\r", format: AllowCRLF, expected: "123", expectedOK: true},
+		{line: "\r", format: AllowCRLF | AllowBlankLines},
+		{line: " \t123 ", format: AllowSpaces, expected: "123", expectedOK: true},
+		{line: "  ", format: AllowSpaces | AllowBlankLines},
+		{line: "  ", format: AllowSpaces, expectedErr: true},
+		{line: "# comment", format: AllowComments},
+		{line: "# comment", format: DefaultFormat, expected: "# comment", expectedOK: true}, // Rejected by parser.
+		{line: "  # comment\r", format: LenientFormat},
+		{line: " +12 \r", format: LenientFormat, expected: "12", expectedOK: true},
+	} {
+		t.Run(tcase.line, func(t *testing.T) {
+			tok, ok, err := tcase.format.Token([]byte(tcase.line))
+			if tcase.expectedErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedOK, ok)
+			testutil.Equals(t, tcase.expected, string(tok))
+		})
+	}
+}
+
+// TestSum_Format tests that all sum implementations agree on the DefaultFormat.
+func TestSum_Format(t *testing.T) {
+	implementations := map[string]func(string) (int64, error){
+		"Sum": Sum, "Sum2": Sum2, "Sum2_scanner": Sum2_scanner, "Sum3": Sum3, "Sum4": Sum4, "Sum4_atoi": Sum4_atoi,
+		"Sum5": Sum5, "Sum5_line": Sum5_line, "Sum6": Sum6, "SumMmap": SumMmap, "SumChecked": SumChecked,
+		"SumWithFormat":  func(fn string) (int64, error) { return SumWithFormat(fn, DefaultFormat) },
+		"ConcurrentSum1": ConcurrentSum1,
+	}
+	for name, f := range map[string]func(string, int) (int64, error){
+		"ConcurrentSum2": ConcurrentSum2, "ConcurrentSum3": ConcurrentSum3, "ConcurrentSum4": ConcurrentSum4,
+		"ConcurrentSumMmap": ConcurrentSumMmap, "ConcurrentSumChecked": ConcurrentSumChecked,
+	} {
+		f := f
+		implementations[name+"/1"] = func(fn string) (int64, error) { return f(fn, 1) }
+		implementations[name+"/2"] = func(fn string) (int64, error) { return f(fn, 2) }
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		input       string
+		expected    int64
+		expectedErr bool
+	}{
+		{name: "trailing newline", input: "1\n-2\n3\n", expected: 2},
+		{name: "no trailing newline", input: "1\n-2\n3", expected: 2},
+		{name: "blank lines", input: "1\n\n\n-2\n3\n\n", expected: 2},
+		{name: "CRLF", input: "1\r\n-2\r\n3\r\n", expectedErr: true},
+		{name: "spaces", input: " 1\n-2\n3\n", expectedErr: true},
+		{name: "plus sign", input: "+1\n-2\n3\n", expectedErr: true},
+		{name: "sign only", input: "1\n-\n3\n", expectedErr: true},
+		{name: "comment", input: "# numbers\n1\n-2\n3\n", expectedErr: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), "input.txt")
+			testutil.Ok(t, os.WriteFile(testFile, []byte(tcase.input), os.ModePerm))
+
+			for name, f := range implementations {
+				ret, err := f(testFile)
+				if tcase.expectedErr {
+					testutil.NotOk(t, err, name)
+					continue
+				}
+				testutil.Ok(t, err, name)
+				testutil.Equals(t, tcase.expected, ret, name)
+			}
+
+			ret, err := SumReaderWithFormat(bytes.NewReader([]byte(tcase.input)), make([]byte, 16), DefaultFormat)
+			if tcase.expectedErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, ret)
+		})
+	}
+}
+
+func TestSum_LenientFormat(t *testing.T) {
+	input := []byte("# Numbers.\r\n  +1 \r\n\r\n-2\t\n\n  # Last one.\n3")
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+	testutil.Ok(t, os.WriteFile(testFile, input, os.ModePerm))
+
+	ret, err := SumWithFormat(testFile, LenientFormat)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2), ret)
+
+	ret, err = SumReaderWithFormat(bytes.NewReader(input), make([]byte, 16), LenientFormat)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2), ret)
+
+	for _, workers := range []int{1, 2, 3} {
+		ret, err = ConcurrentSumWithFormat(testFile, workers, LenientFormat)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(2), ret)
+	}
+
+	_, err = SumWithFormat(testFile, DefaultFormat)
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/runutil"
+)
+
+// inodeOf returns inode of the file or 0 if the platform does not have them.
+func inodeOf(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// IncrementalSummer sums append-only file (e.g. log of integers) incrementally. Each Update reads only bytes
+// appended since the previous one, so keeping the sum up to date costs as much as the new data.
+//
+// The final line without newline is not summed until it is terminated, because the writer might be in the middle
+// of writing it. If the file is truncated (detected when it's smaller than the consumed offset) or replaced
+// (e.g. rotated, detected by inode change), summer starts from the beginning of the new content. Data appended to
+// the old file after the last Update and before rotation is not summed.
+//
+// IncrementalSummer is not safe for concurrent use.
+type IncrementalSummer struct {
+	fileName string
+	buf      []byte
+
+	inode uint64
+	// read is the file offset of the next byte to read.
+	read int64
+	// partial is the length of the unterminated line at the beginning of buf (read, but not summed yet).
+	partial int
+	lines   int
+	total   int64
+}
+
+// NewIncrementalSummer returns summer of the given file. Buffer has to fit the longest line.
+func NewIncrementalSummer(fileName string, buf []byte) *IncrementalSummer {
+	return &IncrementalSummer{fileName: fileName, buf: buf}
+}
+
+// Sum returns the sum of all lines summed so far.
+func (s *IncrementalSummer) Sum() int64 { return s.total }
+
+// Offset returns the file offset up to which all lines are summed.
+func (s *IncrementalSummer) Offset() int64 { return s.read - int64(s.partial) }
+
+func (s *IncrementalSummer) reset(inode uint64) {
+	s.inode = inode
+	s.read, s.partial, s.lines, s.total = 0, 0, 0, 0
+}
+
+// Update reads bytes appended since the last Update and returns the sum of all lines. On ParseError,
+// lines before the invalid one are summed and the next Update fails on the same line.
+func (s *IncrementalSummer) Update() (_ int64, err error) {
+	f, err := os.Open(s.fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, f.Close, "close file")
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if inode := inodeOf(fi); inode != s.inode || fi.Size() < s.read {
+		// Rotated or truncated.
+		s.reset(inode)
+	}
+	if fi.Size() == s.read {
+		return s.total, nil
+	}
+	if _, err := f.Seek(s.read, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for err != io.EOF {
+		if s.partial == len(s.buf) {
+			return 0, errors.Newf("line at byte offset %v is longer than the %v bytes buffer", s.Offset(), len(s.buf))
+		}
+
+		n, err = f.Read(s.buf[s.partial:])
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		s.read += int64(n)
+		n += s.partial
+
+		var last int
+		for i := range s.buf[:n] {
+			if s.buf[i] != '\n' {
+				continue
+			}
+			num, _, pErr := DefaultFormat.ParseInt(s.buf[last:i])
+			if pErr != nil {
+				// Rewind to the invalid line, so state is consistent with what was summed.
+				s.read -= int64(n - last)
+				s.partial = 0
+				return 0, &ParseError{Offset: s.read, Line: s.lines + 1, Err: pErr}
+			}
+			s.total += num
+			s.lines++
+			last = i + 1
+		}
+		s.partial = copy(s.buf, s.buf[last:n])
+	}
+	return s.total, nil
+}
+
+// Tail calls Update every interval until the context is done and calls fn with the sum after each successful
+// Update. Missing file (e.g. in the middle of rotation) is not an error, it's checked again after interval.
+// It returns the first error from Update (other than missing file) or fn.
+func (s *IncrementalSummer) Tail(ctx context.Context, interval time.Duration, fn func(sum int64) error) error {
+	return runutil.Repeat(interval, ctx.Done(), func() error {
+		sum, err := s.Update()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(sum)
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+func appendString(fn string, s string) (err error) {
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer errcapture.Do(&err, f.Close, "close file")
+
+	_, err = f.WriteString(s)
+	return err
+}
+
+func appendToFile(t testing.TB, fn string, s string) {
+	t.Helper()
+
+	testutil.Ok(t, appendString(fn, s))
+}
+
+func TestIncrementalSummer(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "input.log")
+
+	s := NewIncrementalSummer(fn, make([]byte, 16))
+	_, err := s.Update()
+	testutil.Assert(t, errors.Is(err, os.ErrNotExist), "expected missing file, got %v", err)
+
+	for _, tcase := range []struct {
+		appended       string
+		expectedSum    int64
+		expectedOffset int64
+	}{
+		{appended: "", expectedSum: 0, expectedOffset: 0},
+		{appended: "1\n2\n", expectedSum: 3, expectedOffset: 4},
+		{appended: "", expectedSum: 3, expectedOffset: 4},
+		// Partial line is not summed until it's terminated.
+		{appended: "12", expectedSum: 3, expectedOffset: 4},
+		{appended: "34", expectedSum: 3, expectedOffset: 4},
+		{appended: "5\n\n-10\n", expectedSum: 12338, expectedOffset: 15},
+		// More than buffer at once.
+		{appended: "100\n200\n300\n400\n500\n600\n700\n", expectedSum: 15138, expectedOffset: 43},
+	} {
+		appendToFile(t, fn, tcase.appended)
+
+		ret, err := s.Update()
+		testutil.Ok(t, err)
+		testutil.Equals(t, tcase.expectedSum, ret)
+		testutil.Equals(t, tcase.expectedSum, s.Sum())
+		testutil.Equals(t, tcase.expectedOffset, s.Offset())
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		testutil.Ok(t, os.WriteFile(fn, []byte("7\n"), os.ModePerm))
+
+		ret, err := s.Update()
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(7), ret)
+		testutil.Equals(t, int64(2), s.Offset())
+	})
+
+	t.Run("rotated", func(t *testing.T) {
+		// Rotated file is bigger than the consumed offset, only inode tells it's a different file.
+		rotated := filepath.Join(dir, "rotated.log")
+		testutil.Ok(t, os.WriteFile(rotated, []byte("1\n1\n1\n"), os.ModePerm))
+		testutil.Ok(t, os.Rename(rotated, fn))
+
+		ret, err := s.Update()
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(3), ret)
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		appendToFile(t, fn, "2\n12a4\n3\n")
+
+		for i := 0; i < 2; i++ {
+			_, err := s.Update()
+			testutil.NotOk(t, err)
+
+			var pErr *ParseError
+			testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+			testutil.Equals(t, int64(8), pErr.Offset)
+			testutil.Equals(t, 5, pErr.Line)
+
+			// Lines before the invalid one are summed.
+			testutil.Equals(t, int64(5), s.Sum())
+		}
+	})
+
+	t.Run("line longer than buffer", func(t *testing.T) {
+		long := filepath.Join(dir, "long.log")
+		testutil.Ok(t, os.WriteFile(long, []byte("12345678901234567\n"), os.ModePerm))
+		testutil.Ok(t, os.Rename(long, fn))
+
+		_, err := s.Update()
+		testutil.NotOk(t, err)
+	})
+}
+
+func TestIncrementalSummer_Tail(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "input.log")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Writer appends in the meantime, starting after the first update (when the file does not exist yet).
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+
+		for i := 0; i < 10; i++ {
+			time.Sleep(5 * time.Millisecond)
+			if err := appendString(fn, "1\n"); err != nil {
+				errCh <- err
+				cancel()
+				return
+			}
+		}
+	}()
+
+	var sums []int64
+	s := NewIncrementalSummer(fn, make([]byte, 1024))
+	testutil.Ok(t, s.Tail(ctx, 2*time.Millisecond, func(sum int64) error {
+		if len(sums) > 0 && sums[len(sums)-1] > sum {
+			return errors.Newf("sum decreased from %v to %v", sums[len(sums)-1], sum)
+		}
+		sums = append(sums, sum)
+		if sum == 10 {
+			cancel()
+		}
+		return nil
+	}))
+	testutil.Ok(t, <-errCh)
+	testutil.Equals(t, int64(10), sums[len(sums)-1])
+}
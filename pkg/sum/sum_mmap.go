@@ -0,0 +1,61 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"os"
+	"sync/atomic"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/examples/pkg/memory/mmap"
+	"golang.org/x/sys/unix"
+)
+
+// openMmap maps the whole file into memory and advises the kernel we will read it sequentially, so it
+// reads ahead more aggressively. Returned map is nil for empty files, since those can't be mapped.
+func openMmap(fileName string) (*mmap.MemoryMap, error) {
+	s, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if s.Size() == 0 {
+		return nil, nil
+	}
+
+	m, err := mmap.OpenFileBacked(fileName, int(s.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	// mmap.MemoryMap.Advise refuses file backed mappings, but read-ahead advice works fine for those.
+	if err := unix.Madvise(m.Bytes(), unix.MADV_SEQUENTIAL); err != nil {
+		_ = m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// SumMmap is like Sum4, but instead of reading the whole file on heap, it maps it into memory.
+// Page cache is used directly (zero-copy), so it scales to multi-GB files without heap growth.
+func SumMmap(fileName string) (ret int64, err error) {
+	m, err := openMmap(fileName)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, m.Close, "close mmap")
+
+	var stop atomic.Bool
+	return sumRange(m.Bytes(), 0, len(m.Bytes()), DefaultFormat, &stop)
+}
+
+// ConcurrentSumMmap is like ConcurrentSum3, but it shards memory mapped file instead of the one read on heap.
+func ConcurrentSumMmap(fileName string, workers int) (ret int64, err error) {
+	m, err := openMmap(fileName)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, m.Close, "close mmap")
+
+	return concurrentSumBytes(m.Bytes(), workers, DefaultFormat)
+}
@@ -0,0 +1,292 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// maxPoolShardSize is the maximum number of bytes per SumPool shard. Big inputs are split into more shards than
+// workers, so the worker is never occupied by one caller for long and other callers can interleave.
+const maxPoolShardSize = 4 * 1024 * 1024
+
+// ErrPoolClosed is returned by SumPool methods called after Close.
+var ErrPoolClosed = errors.New("sum pool is closed")
+
+// SumPool is a long-lived pool of workers, each with pre-allocated buffer, which sums inputs in the
+// ConcurrentSum4 way. Unlike ConcurrentSum4, it does not spawn goroutines or allocate buffers on every call, and it
+// bounds the concurrency of all callers together (e.g. of all HTTP requests in the server).
+//
+// Each call is split into shards (tasks), which are scheduled fairly: workers take one shard from each caller in
+// round-robin, so a big input does not starve the small ones queued after it.
+//
+// SumPool is safe for concurrent use.
+type SumPool struct {
+	workers int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   []*poolJob
+	closed bool
+	wg     sync.WaitGroup
+
+	workersGauge prometheus.Gauge
+	queued       prometheus.Gauge
+	busy         prometheus.Gauge
+	busySeconds  prometheus.Counter
+	tasks        prometheus.Counter
+}
+
+// NewSumPool starts the pool with the given number of workers, each with buffer of bufSize bytes. Buffer has to fit
+// the longest line. Metrics are registered in reg, if not nil. Utilisation of the pool is
+// rate(sum_pool_busy_seconds_total) / sum_pool_workers. Call Close to stop workers.
+func NewSumPool(reg prometheus.Registerer, workers int, bufSize int) *SumPool {
+	p := newSumPool(reg, workers)
+	p.wg.Add(p.workers)
+	for i := 0; i < p.workers; i++ {
+		go p.worker(make([]byte, bufSize))
+	}
+	return p
+}
+
+// newSumPool returns pool without workers.
+func newSumPool(reg prometheus.Registerer, workers int) *SumPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &SumPool{
+		workers: workers,
+		workersGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "sum_pool_workers",
+			Help: "Number of workers in the sum pool.",
+		}),
+		queued: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "sum_pool_queued_tasks",
+			Help: "Number of tasks (shards) waiting for a sum pool worker.",
+		}),
+		busy: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "sum_pool_busy_workers",
+			Help: "Number of sum pool workers processing a task.",
+		}),
+		busySeconds: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "sum_pool_busy_seconds_total",
+			Help: "Total time sum pool workers spent processing tasks.",
+		}),
+		tasks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "sum_pool_tasks_total",
+			Help: "Total number of tasks (shards) processed by the sum pool.",
+		}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	p.workersGauge.Set(float64(workers))
+	return p
+}
+
+// poolJob is a single call to the pool, split into shards.
+type poolJob struct {
+	ctx  context.Context
+	r    io.ReaderAt
+	size int64
+	// stream is read by a single task instead of r, if not nil.
+	stream     io.Reader
+	compressed bool
+
+	shards   int
+	next     int
+	stop     atomic.Bool
+	resultCh chan result
+}
+
+// stopped returns errStopped if other shard failed, or context error if the caller gave up.
+func (j *poolJob) stopped() error {
+	if j.stop.Load() {
+		return errStopped
+	}
+	return j.ctx.Err()
+}
+
+func (j *poolJob) sum(shard int, buf []byte) (int64, error) {
+	if err := j.stopped(); err != nil {
+		return 0, err
+	}
+	if j.stream != nil {
+		return sumReader(j.stream, buf, DefaultFormat, j.stopped, nil)
+	}
+	if j.compressed {
+		return j.sumCompressed(buf)
+	}
+
+	begin, end, err := shardedRangeFromReaderAt(shard, j.shards, int(j.size), j.r)
+	if err != nil {
+		return 0, err
+	}
+	sum, err := sumReader(io.NewSectionReader(j.r, int64(begin), int64(end-begin)), buf, DefaultFormat, j.stopped, nil)
+	if err != nil {
+		shardParseErrorToFile(err, j.r, begin)
+	}
+	return sum, err
+}
+
+func (j *poolJob) sumCompressed(buf []byte) (_ int64, err error) {
+	dr, _, err := Decompress(io.NewSectionReader(j.r, 0, j.size))
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, dr.Close, "close decompressor")
+
+	return sumReader(dr, buf, DefaultFormat, j.stopped, nil)
+}
+
+func (p *SumPool) worker(buf []byte) {
+	defer p.wg.Done()
+
+	for {
+		j, shard, ok := p.nextTask()
+		if !ok {
+			return
+		}
+
+		p.busy.Inc()
+		start := time.Now()
+		sum, err := j.sum(shard, buf)
+		if err != nil && err != errStopped {
+			j.stop.Store(true)
+		}
+		p.busySeconds.Add(time.Since(start).Seconds())
+		p.busy.Dec()
+		p.tasks.Inc()
+
+		j.resultCh <- result{sum: sum, err: err}
+	}
+}
+
+// nextTask blocks until there is a task and returns it. It returns false if the pool is closed and all
+// queued tasks are taken. Queued tasks of stopped jobs (canceled by the caller or with a failed shard) are dropped
+// without taking a worker, their results are the stop errors.
+func (p *SumPool) nextTask() (*poolJob, int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		for len(p.jobs) == 0 {
+			if p.closed {
+				return nil, 0, false
+			}
+			p.cond.Wait()
+		}
+
+		// Round-robin: take one shard of the first job and move the job to the back of the queue.
+		j := p.jobs[0]
+		copy(p.jobs, p.jobs[1:])
+		p.jobs = p.jobs[:len(p.jobs)-1]
+
+		if err := j.stopped(); err != nil {
+			// Result channel is buffered for all shards, so it never blocks.
+			p.queued.Sub(float64(j.shards - j.next))
+			for ; j.next < j.shards; j.next++ {
+				j.resultCh <- result{err: err}
+			}
+			continue
+		}
+
+		shard := j.next
+		j.next++
+		if j.next < j.shards {
+			p.jobs = append(p.jobs, j)
+		}
+		p.queued.Dec()
+		return j, shard, true
+	}
+}
+
+func (p *SumPool) enqueue(j *poolJob) error {
+	j.resultCh = make(chan result, j.shards)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+	p.jobs = append(p.jobs, j)
+	p.queued.Add(float64(j.shards))
+	p.cond.Broadcast()
+	return nil
+}
+
+// do enqueues the job and waits for all its shards.
+func (p *SumPool) do(j *poolJob) (int64, error) {
+	if err := p.enqueue(j); err != nil {
+		return 0, err
+	}
+	return collect(j.resultCh, j.shards)
+}
+
+// poolShards returns the number of shards for size bytes: at least one per worker (if there are enough bytes),
+// but no bigger than maxPoolShardSize.
+func poolShards(size int, workers int) int {
+	shards := shardWorkers(size, workers)
+	if s := (size + maxPoolShardSize - 1) / maxPoolShardSize; s > shards {
+		shards = s
+	}
+	return shards
+}
+
+// SumReaderAt sums integers from r of the given size, like ConcurrentSum4. It returns when all shards are
+// summed, or when context is done (once workers notice it, which can take up to a shard, if they are all busy).
+// Parse errors are returned as ParseError with position in r.
+func (p *SumPool) SumReaderAt(ctx context.Context, r io.ReaderAt, size int64) (int64, error) {
+	return p.do(&poolJob{ctx: ctx, r: r, size: size, shards: poolShards(int(size), p.workers)})
+}
+
+// SumFile is like ConcurrentSum4, but it uses the pool workers (a single one for compressed input).
+func (p *SumPool) SumFile(ctx context.Context, fileName string) (ret int64, err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer errcapture.Do(&err, f.Close, "close file")
+
+	s, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, magicLen)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if DetectCompression(header[:n]) != NoCompression {
+		return p.do(&poolJob{ctx: ctx, r: f, size: s.Size(), compressed: true, shards: 1})
+	}
+	return p.SumReaderAt(ctx, f, s.Size())
+}
+
+// SumReader sums integers from the stream with a single pool worker, like SumReaderContext, but without
+// allocating a buffer. Useful for inputs which can't be read at random offsets (e.g. object storage streams).
+func (p *SumPool) SumReader(ctx context.Context, r io.Reader) (int64, error) {
+	return p.do(&poolJob{ctx: ctx, stream: r, shards: 1})
+}
+
+// Close stops the pool once all queued tasks are processed. Calls after Close return ErrPoolClosed.
+func (p *SumPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
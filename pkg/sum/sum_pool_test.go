@@ -0,0 +1,191 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSumPool(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	p := NewSumPool(reg, 4, 1024)
+	t.Cleanup(func() { testutil.Ok(t, p.Close()) })
+
+	buf := bytes.Buffer{}
+	expectedSum, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e5)
+	testutil.Ok(t, err)
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+	testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+	t.Run("file", func(t *testing.T) {
+		ret, err := p.SumFile(ctx, testFile)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	})
+	t.Run("compressed file", func(t *testing.T) {
+		compressedFile := filepath.Join(t.TempDir(), "input.txt.gz")
+		testutil.Ok(t, os.WriteFile(compressedFile, compress(t, Gzip, buf.Bytes()), os.ModePerm))
+
+		ret, err := p.SumFile(ctx, compressedFile)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	})
+	t.Run("reader at", func(t *testing.T) {
+		for _, input := range [][]byte{nil, []byte("1\n2\n3"), longLinesInput(1, 1e3), buf.Bytes()} {
+			expected, err := Sum6Reader(bytes.NewReader(input), make([]byte, 1024))
+			testutil.Ok(t, err)
+
+			ret, err := p.SumReaderAt(ctx, bytes.NewReader(input), int64(len(input)))
+			testutil.Ok(t, err)
+			testutil.Equals(t, expected, ret)
+		}
+	})
+	t.Run("reader", func(t *testing.T) {
+		ret, err := p.SumReader(ctx, bytes.NewReader(buf.Bytes()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	})
+	t.Run("concurrent callers", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		errCh := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				input := buf.Bytes()[:len(buf.Bytes())*(i+1)/20]
+				expected, err := Sum6Reader(bytes.NewReader(input), make([]byte, 1024))
+				if err != nil {
+					errCh <- err
+					return
+				}
+				ret, err := p.SumReaderAt(ctx, bytes.NewReader(input), int64(len(input)))
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if ret != expected {
+					errCh <- errors.Newf("caller %v: expected %v, got %v", i, expected, ret)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errCh)
+		for err := range errCh {
+			testutil.Ok(t, err)
+		}
+	})
+	t.Run("invalid input", func(t *testing.T) {
+		input := append(append([]byte{}, buf.Bytes()...), []byte("12a4\n")...)
+		_, err := p.SumReaderAt(ctx, bytes.NewReader(input), int64(len(input)))
+		testutil.NotOk(t, err)
+
+		var pErr *ParseError
+		testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+		testutil.Equals(t, int64(buf.Len()), pErr.Offset)
+		testutil.Equals(t, int(1e5)+1, pErr.Line)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := p.SumFile(cctx, testFile)
+		testutil.NotOk(t, err)
+		testutil.Assert(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+	})
+	t.Run("metrics", func(t *testing.T) {
+		testutil.Equals(t, float64(4), promtestutil.ToFloat64(p.workersGauge))
+		testutil.Equals(t, float64(0), promtestutil.ToFloat64(p.queued))
+		testutil.Equals(t, float64(0), promtestutil.ToFloat64(p.busy))
+		testutil.Assert(t, promtestutil.ToFloat64(p.tasks) > 0)
+		testutil.Assert(t, promtestutil.ToFloat64(p.busySeconds) > 0)
+
+		n, err := promtestutil.GatherAndCount(reg)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 5, n)
+	})
+}
+
+func TestSumPool_Close(t *testing.T) {
+	p := NewSumPool(nil, 2, 1024)
+	testutil.Ok(t, p.Close())
+
+	_, err := p.SumReader(context.Background(), bytes.NewReader([]byte("1\n")))
+	testutil.Equals(t, ErrPoolClosed, err)
+}
+
+func TestSumPool_FairScheduling(t *testing.T) {
+	// No workers, so we can take tasks ourselves.
+	p := newSumPool(nil, 1)
+
+	jobs := map[*poolJob]string{}
+	for name, shards := range map[string]int{"a": 3, "b": 1, "c": 2} {
+		j := &poolJob{ctx: context.Background(), shards: shards}
+		jobs[j] = name
+		testutil.Ok(t, p.enqueue(j))
+	}
+	testutil.Equals(t, float64(6), promtestutil.ToFloat64(p.queued))
+
+	// Order of jobs depends on map iteration, but each job has to get one task per round.
+	var taken []string
+	for i := 0; i < 6; i++ {
+		j, _, ok := p.nextTask()
+		testutil.Assert(t, ok)
+		taken = append(taken, jobs[j])
+	}
+	sort.Strings(taken[:3])
+	sort.Strings(taken[3:5])
+	testutil.Equals(t, []string{"a", "b", "c", "a", "c", "a"}, taken)
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(p.queued))
+}
+
+func TestSumPool_DropStoppedJobs(t *testing.T) {
+	// No workers, so we can take tasks ourselves.
+	p := newSumPool(nil, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := &poolJob{ctx: ctx, shards: 3}
+	failed := &poolJob{ctx: context.Background(), shards: 2}
+	live := &poolJob{ctx: context.Background(), shards: 2}
+	for _, j := range []*poolJob{canceled, failed, live} {
+		testutil.Ok(t, p.enqueue(j))
+	}
+
+	j, _, ok := p.nextTask()
+	testutil.Assert(t, ok)
+	testutil.Equals(t, canceled, j)
+	j.resultCh <- result{sum: 1}
+	cancel()
+	failed.stop.Store(true)
+
+	// Remaining tasks of the canceled and failed jobs are dropped.
+	for i := 0; i < 2; i++ {
+		j, _, ok = p.nextTask()
+		testutil.Assert(t, ok)
+		testutil.Equals(t, live, j)
+		j.resultCh <- result{sum: 1}
+	}
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(p.queued))
+
+	_, err := collect(canceled.resultCh, canceled.shards)
+	testutil.Assert(t, errors.Is(err, context.Canceled), "expected canceled, got %v", err)
+	_, err = collect(failed.resultCh, failed.shards)
+	testutil.Equals(t, errStopped, err)
+	ret, err := collect(live.resultCh, live.shards)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2), ret)
+}
@@ -0,0 +1,401 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"context"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+
+	"github.com/efficientgo/core/errcapture"
+	"github.com/efficientgo/core/errors"
+)
+
+// Stats accumulates basic statistics of integers in a single pass. Stats computed for different shards
+// of the input can be merged, so sharded computations don't need extra passes.
+// Use SumN functions if you only need the sum, those are much faster.
+type Stats struct {
+	Count int64
+	Sum   int64
+	// Min and Max are 0 if Count is 0.
+	Min, Max int64
+	// Invalid is the number of invalid lines skipped by SumStatsReaderContext. Other functions fail on the first
+	// invalid line, so it's 0 for them.
+	Invalid int64
+
+	// Bounds are inclusive upper bounds of the histogram buckets, in increasing order.
+	Bounds []int64
+	// Buckets are counts of numbers in each bucket. The last bucket counts numbers larger
+	// than the last bound, so len(Buckets) == len(Bounds)+1.
+	Buckets []int64
+
+	// mean and m2 are state of the Welford's online algorithm, which is numerically stable.
+	mean, m2 float64
+}
+
+// NewStats returns empty Stats with the histogram of the given bucket bounds (can be empty). Bounds have to be
+// strictly increasing, otherwise the histogram is wrong; use ValidateBounds to check bounds from users.
+// Zero value of Stats is fine too, it has a histogram without bounds, so with a single bucket.
+func NewStats(bounds []int64) *Stats {
+	return &Stats{Bounds: bounds, Buckets: make([]int64, len(bounds)+1)}
+}
+
+// ValidateBounds returns an error if the histogram bounds are not strictly increasing.
+func ValidateBounds(bounds []int64) error {
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return errors.Newf("histogram bounds have to be strictly increasing, got %v", bounds)
+		}
+	}
+	return nil
+}
+
+// initBuckets allocates buckets of Stats created without NewStats.
+func (s *Stats) initBuckets() error {
+	if s.Buckets == nil {
+		s.Buckets = make([]int64, len(s.Bounds)+1)
+	}
+	if len(s.Buckets) != len(s.Bounds)+1 {
+		return errors.Newf("stats have %d buckets for %d bounds, expected %d", len(s.Buckets), len(s.Bounds), len(s.Bounds)+1)
+	}
+	return nil
+}
+
+// Add adds a number to statistics. It panics if Buckets were set without matching Bounds.
+func (s *Stats) Add(v int64) {
+	if s.Buckets == nil {
+		s.Buckets = make([]int64, len(s.Bounds)+1)
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+
+	delta := float64(v) - s.mean
+	s.mean += delta / float64(s.Count)
+	s.m2 += delta * (float64(v) - s.mean)
+
+	// Binary search for the first bound not smaller than v, like sort.Search, but without closure per call.
+	i, j := 0, len(s.Bounds)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if s.Bounds[h] < v {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	s.Buckets[i]++
+}
+
+// Merge adds statistics from o to s, as if all numbers added to o were added to s. Both have to use the same
+// histogram bounds.
+func (s *Stats) Merge(o *Stats) error {
+	if len(s.Bounds) != len(o.Bounds) {
+		return errors.Newf("can't merge stats with different histogram bounds %v and %v", s.Bounds, o.Bounds)
+	}
+	for i := range s.Bounds {
+		if s.Bounds[i] != o.Bounds[i] {
+			return errors.Newf("can't merge stats with different histogram bounds %v and %v", s.Bounds, o.Bounds)
+		}
+	}
+	if err := s.initBuckets(); err != nil {
+		return err
+	}
+	if o.Count > 0 && len(o.Buckets) != len(o.Bounds)+1 {
+		return errors.Newf("can't merge stats with %d buckets for %d bounds", len(o.Buckets), len(o.Bounds))
+	}
+
+	s.Invalid += o.Invalid
+	if o.Count == 0 {
+		return nil
+	}
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+
+	// Chan et al. parallel variant of Welford's algorithm.
+	count := s.Count + o.Count
+	delta := o.mean - s.mean
+	s.mean += delta * float64(o.Count) / float64(count)
+	s.m2 += o.m2 + delta*delta*float64(s.Count)*float64(o.Count)/float64(count)
+
+	s.Count = count
+	s.Sum += o.Sum
+	for i := range o.Buckets {
+		s.Buckets[i] += o.Buckets[i]
+	}
+	return nil
+}
+
+// Mean returns arithmetic mean of the numbers, NaN if there were none.
+func (s *Stats) Mean() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.mean
+}
+
+// Variance returns population variance of the numbers, NaN if there were none.
+func (s *Stats) Variance() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.m2 / float64(s.Count)
+}
+
+// SumStats is like Sum4, but it computes Stats, not only sum.
+func SumStats(fileName string, bounds []int64) (*Stats, error) {
+	if err := ValidateBounds(bounds); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewStats(bounds)
+	var stop atomic.Bool
+	if err := statsRange(b, 0, len(b), s, &stop); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// addLine parses the line and adds it to stats, unless it is skipped by the format.
+func (s *Stats) addLine(line []byte) error {
+	num, ok, err := DefaultFormat.ParseInt(line)
+	if err != nil || !ok {
+		return err
+	}
+	s.Add(num)
+	return nil
+}
+
+// statsRange is like sumRange, but it adds numbers to stats.
+func statsRange(b []byte, begin, end int, s *Stats, stop *atomic.Bool) error {
+	last := begin
+	for ; begin < end; begin++ {
+		if b[begin] != '\n' {
+			continue
+		}
+		if stop.Load() {
+			return errStopped
+		}
+		if err := s.addLine(b[last:begin]); err != nil {
+			stop.Store(true)
+			return newParseError(b, last, err)
+		}
+		last = begin + 1
+	}
+
+	if last < end {
+		// Final line without newline.
+		if err := s.addLine(b[last:end]); err != nil {
+			stop.Store(true)
+			return newParseError(b, last, err)
+		}
+	}
+	return nil
+}
+
+// SumStatsReader is like Sum6Reader, but it computes Stats, not only sum.
+func SumStatsReader(r io.Reader, buf []byte, bounds []int64) (*Stats, error) {
+	if err := ValidateBounds(bounds); err != nil {
+		return nil, err
+	}
+
+	s := NewStats(bounds)
+	if err := statsReader(r, buf, s, false, func() error { return nil }); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SumStatsReaderContext is like SumStatsReader, but it gives up once ctx is done. If skipInvalid is true, invalid
+// lines are skipped and counted in Stats.Invalid, instead of failing the whole input.
+func SumStatsReaderContext(ctx context.Context, r io.Reader, buf []byte, bounds []int64, skipInvalid bool) (*Stats, error) {
+	if err := ValidateBounds(bounds); err != nil {
+		return nil, err
+	}
+
+	s := NewStats(bounds)
+	if err := statsReader(r, buf, s, skipInvalid, ctx.Err); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// statsReader is like sumReader, but it adds numbers to stats.
+func statsReader(r io.Reader, buf []byte, s *Stats, skipInvalid bool, stopped func() error) (err error) {
+	var (
+		offset, n int
+		consumed  int64
+		lines     int
+	)
+	for err != io.EOF {
+		if err := stopped(); err != nil {
+			return err
+		}
+		if offset == len(buf) {
+			return errors.Newf("line at byte offset %v is longer than the %v bytes buffer", consumed, len(buf))
+		}
+
+		n, err = r.Read(buf[offset:])
+		if err != nil && err != io.EOF {
+			return err
+		}
+		n += offset
+
+		var last int
+		for i := range buf[:n] {
+			if buf[i] != '\n' {
+				continue
+			}
+			if err := s.addLine(buf[last:i]); err != nil {
+				if !skipInvalid {
+					return &ParseError{Offset: consumed + int64(last), Line: lines + 1, Err: err}
+				}
+				s.Invalid++
+			}
+			lines++
+			last = i + 1
+		}
+
+		consumed += int64(last)
+		offset = n - last
+		if offset > 0 {
+			_ = copy(buf, buf[last:n])
+		}
+	}
+
+	if offset > 0 {
+		// Final line without newline.
+		if err := s.addLine(buf[:offset]); err != nil {
+			if !skipInvalid {
+				return &ParseError{Offset: consumed, Line: lines + 1, Err: err}
+			}
+			s.Invalid++
+		}
+	}
+	return nil
+}
+
+type statsResult struct {
+	stats *Stats
+	err   error
+}
+
+// collectStats is like collect, but for stats.
+func collectStats(resultCh <-chan statsResult, workers int, bounds []int64) (_ *Stats, err error) {
+	ret := NewStats(bounds)
+	for i := 0; i < workers; i++ {
+		r := <-resultCh
+		if r.err != nil {
+			if err == nil || err == errStopped {
+				err = r.err
+			}
+			continue
+		}
+		if mErr := ret.Merge(r.stats); mErr != nil && err == nil {
+			err = mErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ConcurrentSumStats3 is like ConcurrentSum3, but each worker computes Stats of its shard, which are merged at the end.
+func ConcurrentSumStats3(fileName string, workers int, bounds []int64) (*Stats, error) {
+	if err := ValidateBounds(bounds); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		resultCh = make(chan statsResult)
+		stop     atomic.Bool
+	)
+	workers = shardWorkers(len(b), workers)
+
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			begin, end := shardedRange(i, workers, b)
+
+			s := NewStats(bounds)
+			err := statsRange(b, begin, end, s, &stop)
+			resultCh <- statsResult{stats: s, err: err}
+		}(i)
+	}
+
+	ret, err := collectStats(resultCh, workers, bounds)
+	close(resultCh)
+	return ret, err
+}
+
+// ConcurrentSumStats4 is like ConcurrentSum4, but each worker computes Stats of its shard, which are merged at the end.
+func ConcurrentSumStats4(fileName string, workers int, bounds []int64) (_ *Stats, err error) {
+	if err := ValidateBounds(bounds); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer errcapture.Do(&err, f.Close, "close file")
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		size     = int(fi.Size())
+		resultCh = make(chan statsResult)
+		stop     atomic.Bool
+	)
+	workers = shardWorkers(size, workers)
+
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			begin, end, err := shardedRangeFromReaderAt(i, workers, size, f)
+			if err != nil {
+				stop.Store(true)
+				resultCh <- statsResult{err: err}
+				return
+			}
+			r := io.NewSectionReader(f, int64(begin), int64(end-begin))
+
+			s := NewStats(bounds)
+			if err := statsReader(r, make([]byte, 8*1024), s, false, stopped(&stop)); err != nil {
+				stop.Store(true)
+				shardParseErrorToFile(err, f, begin)
+				resultCh <- statsResult{err: err}
+				return
+			}
+			resultCh <- statsResult{stats: s}
+		}(i)
+	}
+
+	ret, err := collectStats(resultCh, workers, bounds)
+	close(resultCh)
+	return ret, err
+}
@@ -0,0 +1,232 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+// naiveStats computes stats with two passes, as reference.
+func naiveStats(nums []int64, bounds []int64) (s Stats, mean, variance float64) {
+	s = *NewStats(bounds)
+	for i, n := range nums {
+		if i == 0 || n < s.Min {
+			s.Min = n
+		}
+		if i == 0 || n > s.Max {
+			s.Max = n
+		}
+		s.Count++
+		s.Sum += n
+		mean += float64(n)
+
+		b := len(bounds)
+		for j, bound := range bounds {
+			if n <= bound {
+				b = j
+				break
+			}
+		}
+		s.Buckets[b]++
+	}
+	mean /= float64(len(nums))
+	for _, n := range nums {
+		variance += (float64(n) - mean) * (float64(n) - mean)
+	}
+	return s, mean, variance / float64(len(nums))
+}
+
+func testStatsEquals(t *testing.T, nums []int64, bounds []int64, got *Stats) {
+	t.Helper()
+
+	exp, mean, variance := naiveStats(nums, bounds)
+	testutil.Equals(t, exp.Count, got.Count)
+	testutil.Equals(t, exp.Sum, got.Sum)
+	testutil.Equals(t, exp.Min, got.Min)
+	testutil.Equals(t, exp.Max, got.Max)
+	testutil.Equals(t, exp.Buckets, got.Buckets)
+	testutil.Assert(t, math.Abs(mean-got.Mean()) < 1e-6, "expected mean %v, got %v", mean, got.Mean())
+	testutil.Assert(t, math.Abs(variance-got.Variance())/variance < 1e-9, "expected variance %v, got %v", variance, got.Variance())
+}
+
+func TestStats(t *testing.T) {
+	bounds := []int64{-1000, 0, 10, 100, 1000, 1e6}
+
+	r := rand.New(rand.NewSource(1))
+	nums := make([]int64, 1e5)
+	input := bytes.Buffer{}
+	for i := range nums {
+		nums[i] = r.Int63n(2e6) - 1e6
+		input.WriteString(strconv.FormatInt(nums[i], 10))
+		input.WriteString("\n")
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		s := NewStats(bounds)
+		for _, n := range nums {
+			s.Add(n)
+		}
+		testStatsEquals(t, nums, bounds, s)
+	})
+	t.Run("Merge", func(t *testing.T) {
+		s := NewStats(bounds)
+		for _, shard := range [][]int64{nums[:10], nums[10:10], nums[10:5000], nums[5000:]} {
+			o := NewStats(bounds)
+			for _, n := range shard {
+				o.Add(n)
+			}
+			testutil.Ok(t, s.Merge(o))
+		}
+		testStatsEquals(t, nums, bounds, s)
+
+		testutil.NotOk(t, s.Merge(NewStats(nil)))
+		testutil.NotOk(t, s.Merge(NewStats([]int64{-1000, 0, 10, 100, 1000, 1e7})))
+	})
+	t.Run("empty", func(t *testing.T) {
+		s := NewStats(nil)
+		testutil.Equals(t, int64(0), s.Count)
+		testutil.Assert(t, math.IsNaN(s.Mean()))
+		testutil.Assert(t, math.IsNaN(s.Variance()))
+		testutil.Equals(t, []int64{0}, s.Buckets)
+	})
+	t.Run("zero value", func(t *testing.T) {
+		s := &Stats{}
+		s.Add(5)
+		testutil.Equals(t, []int64{1}, s.Buckets)
+
+		o := &Stats{}
+		testutil.Ok(t, o.Merge(s))
+		testutil.Ok(t, o.Merge(&Stats{}))
+		testutil.Equals(t, int64(1), o.Count)
+		testutil.Equals(t, []int64{1}, o.Buckets)
+
+		b := &Stats{Bounds: bounds}
+		for _, n := range nums {
+			b.Add(n)
+		}
+		testStatsEquals(t, nums, bounds, b)
+
+		m := &Stats{Bounds: bounds}
+		testutil.Ok(t, m.Merge(b))
+		testStatsEquals(t, nums, bounds, m)
+
+		testutil.NotOk(t, (&Stats{Bounds: bounds, Buckets: make([]int64, 2)}).Merge(b))
+		testutil.NotOk(t, m.Merge(&Stats{Count: 1, Bounds: bounds, Buckets: make([]int64, 2)}))
+	})
+
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+	testutil.Ok(t, os.WriteFile(testFile, input.Bytes(), os.ModePerm))
+
+	t.Run("SumStats", func(t *testing.T) {
+		s, err := SumStats(testFile, bounds)
+		testutil.Ok(t, err)
+		testStatsEquals(t, nums, bounds, s)
+	})
+	t.Run("SumStatsReader", func(t *testing.T) {
+		s, err := SumStatsReader(bytes.NewReader(input.Bytes()), make([]byte, 1024), bounds)
+		testutil.Ok(t, err)
+		testStatsEquals(t, nums, bounds, s)
+	})
+	t.Run("SumStatsReaderContext", func(t *testing.T) {
+		s, err := SumStatsReaderContext(context.Background(), bytes.NewReader(input.Bytes()), make([]byte, 1024), bounds, false)
+		testutil.Ok(t, err)
+		testStatsEquals(t, nums, bounds, s)
+		testutil.Equals(t, int64(0), s.Invalid)
+	})
+	for _, workers := range []int{1, 4, 11} {
+		t.Run("ConcurrentSumStats3", func(t *testing.T) {
+			s, err := ConcurrentSumStats3(testFile, workers, bounds)
+			testutil.Ok(t, err)
+			testStatsEquals(t, nums, bounds, s)
+		})
+		t.Run("ConcurrentSumStats4", func(t *testing.T) {
+			s, err := ConcurrentSumStats4(testFile, workers, bounds)
+			testutil.Ok(t, err)
+			testStatsEquals(t, nums, bounds, s)
+		})
+	}
+}
+
+func TestValidateBounds(t *testing.T) {
+	for _, tcase := range []struct {
+		name   string
+		bounds []int64
+		ok     bool
+	}{
+		{name: "nil", ok: true},
+		{name: "single", bounds: []int64{1}, ok: true},
+		{name: "increasing", bounds: []int64{-1, 0, 10}, ok: true},
+		{name: "unsorted", bounds: []int64{0, 10, -1}},
+		{name: "duplicate", bounds: []int64{0, 10, 10}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			err := ValidateBounds(tcase.bounds)
+			if tcase.ok {
+				testutil.Ok(t, err)
+				return
+			}
+			testutil.NotOk(t, err)
+
+			testFile := filepath.Join(t.TempDir(), "input.txt")
+			testutil.Ok(t, os.WriteFile(testFile, []byte("1\n2\n"), os.ModePerm))
+
+			_, err = SumStats(testFile, tcase.bounds)
+			testutil.NotOk(t, err)
+			_, err = SumStatsReader(bytes.NewReader([]byte("1\n")), make([]byte, 16), tcase.bounds)
+			testutil.NotOk(t, err)
+			_, err = SumStatsReaderContext(context.Background(), bytes.NewReader([]byte("1\n")), make([]byte, 16), tcase.bounds, true)
+			testutil.NotOk(t, err)
+			_, err = ConcurrentSumStats3(testFile, 2, tcase.bounds)
+			testutil.NotOk(t, err)
+			_, err = ConcurrentSumStats4(testFile, 2, tcase.bounds)
+			testutil.NotOk(t, err)
+		})
+	}
+}
+
+func TestStats_InvalidInput(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+	testutil.Ok(t, os.WriteFile(testFile, []byte("100\n200\n300\n400\n500\n600\n70a\n800\n900\n"), os.ModePerm))
+
+	_, err := SumStats(testFile, nil)
+	testutil.NotOk(t, err)
+	_, err = ConcurrentSumStats3(testFile, 2, nil)
+	testutil.NotOk(t, err)
+	_, err = ConcurrentSumStats4(testFile, 2, nil)
+	testutil.NotOk(t, err)
+}
+
+func TestSumStatsReaderContext_SkipInvalid(t *testing.T) {
+	input := []byte("100\n200\n\n70a\n-300\n+1\n 4\n500\nx")
+
+	_, err := SumStatsReaderContext(context.Background(), bytes.NewReader(input), make([]byte, 16), nil, false)
+	testutil.NotOk(t, err)
+
+	s, err := SumStatsReaderContext(context.Background(), bytes.NewReader(input), make([]byte, 16), nil, true)
+	testutil.Ok(t, err)
+	testStatsEquals(t, []int64{100, 200, -300, 500}, nil, s)
+	testutil.Equals(t, int64(4), s.Invalid)
+
+	o := NewStats(nil)
+	o.Invalid = 2
+	testutil.Ok(t, s.Merge(o))
+	testutil.Equals(t, int64(6), s.Invalid)
+	testutil.Equals(t, int64(4), s.Count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = SumStatsReaderContext(ctx, bytes.NewReader(input), make([]byte, 16), nil, true)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,169 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/efficientgo/core/errors"
+)
+
+const (
+	swarZeros = 0x3030303030303030 // Eight '0'.
+	swarHigh  = 0x8080808080808080
+)
+
+// ParseIntSWAR is like ParseInt (same results, including wrapping on overflow, and same errors), but it
+// validates and converts 8 digits at once with uint64 arithmetic (SIMD within a register). Shorter numbers
+// are padded with leading zeros, so all numbers up to 8 digits are converted in a single step.
+func ParseIntSWAR(input []byte) (int64, error) {
+	if len(input) == 0 {
+		return 0, errors.New("not a valid integer: empty input")
+	}
+
+	digits := input
+	neg := input[0] == '-'
+	if neg {
+		if len(input) == 1 {
+			return 0, errors.Newf("not a valid integer: %v", input)
+		}
+		digits = input[1:]
+	}
+
+	// The first chunk takes the remainder, so all the next ones are full.
+	n := len(digits) % 8
+	if n == 0 {
+		n = 8
+	}
+
+	var u uint64
+	for len(digits) > 0 {
+		v := loadDigits(digits, n)
+		// Bytes lower than '0' borrow and bytes higher than '9' carry into the high bit of the byte.
+		if ((v-swarZeros)|(v+0x4646464646464646))&swarHigh != 0 {
+			return 0, errors.Newf("not a valid integer: %v", input)
+		}
+		// Same as ParseInt, this overflows silently.
+		u = u*1e8 + eightDigits(v-swarZeros)
+
+		digits = digits[n:]
+		n = 8
+	}
+
+	if neg {
+		return -int64(u), nil
+	}
+	return int64(u), nil
+}
+
+// loadDigits loads first n (1-8) bytes of b into uint64, so the first byte is the most significant digit
+// (little-endian). For n < 8 it pads the number with leading '0'.
+func loadDigits(b []byte, n int) uint64 {
+	var v uint64
+	if cap(b) >= 8 {
+		// Lines are usually sub-slices of a bigger buffer, so we can load 8 bytes at once and drop the ones after n.
+		v = binary.LittleEndian.Uint64(b[:8])
+	} else {
+		var a [8]byte
+		copy(a[:], b[:n])
+		v = binary.LittleEndian.Uint64(a[:])
+	}
+	if n < 8 {
+		v = v<<(8*(8-n)) | swarZeros>>(8*n)
+	}
+	return v
+}
+
+// eightDigits converts 8 digit values (0-9) into the number, by combining pairs of digits, then pairs of pairs etc.
+// See https://lemire.me/blog/2022/01/21/swar-explained-parsing-eight-digits/.
+func eightDigits(v uint64) uint64 {
+	v = (v * (1 + 10<<8)) >> 8
+	v = ((v & 0x00FF00FF00FF00FF) * (1 + 100<<16)) >> 16
+	return ((v & 0x0000FFFF0000FFFF) * (1 + 10000<<32)) >> 32
+}
+
+// Sum4_swar is like Sum4, but it uses ParseIntSWAR and finds newlines with bytes.IndexByte (vectorized by Go).
+// It pays off for long numbers only. For our test input (3-5 digits per line) it's ~40% slower than Sum4,
+// because the IndexByte call per short line costs more than the byte loop it replaces.
+func Sum4_swar(fileName string) (ret int64, err error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			// Final line without newline.
+			i = len(b)
+		}
+		// Same as DefaultFormat, the only skipped lines are blank ones.
+		if i > 0 {
+			num, err := ParseIntSWAR(b[:i])
+			if err != nil {
+				return 0, err
+			}
+			ret += num
+		}
+		if i == len(b) {
+			break
+		}
+		b = b[i+1:]
+	}
+	return ret, nil
+}
+
+// Sum6Reader_swar is like Sum6Reader, but it uses ParseIntSWAR and finds newlines with bytes.IndexByte.
+func Sum6Reader_swar(r io.Reader, buf []byte) (ret int64, err error) {
+	var (
+		offset, n int
+		consumed  int64
+	)
+	for err != io.EOF {
+		if offset == len(buf) {
+			return 0, errors.Newf("line at byte offset %v is longer than the %v bytes buffer", consumed, len(buf))
+		}
+
+		n, err = r.Read(buf[offset:])
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		n += offset
+
+		var last int
+		for {
+			i := bytes.IndexByte(buf[last:n], '\n')
+			if i < 0 {
+				break
+			}
+			if i > 0 {
+				num, err := ParseIntSWAR(buf[last : last+i])
+				if err != nil {
+					return 0, err
+				}
+				ret += num
+			}
+			last += i + 1
+		}
+
+		consumed += int64(last)
+		offset = n - last
+		if offset > 0 {
+			_ = copy(buf, buf[last:n])
+		}
+	}
+
+	if offset > 0 {
+		// Final line without newline.
+		num, err := ParseIntSWAR(buf[:offset])
+		if err != nil {
+			return 0, err
+		}
+		ret += num
+	}
+	return ret, nil
+}
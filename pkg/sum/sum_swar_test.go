@@ -0,0 +1,166 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sum
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/examples/pkg/sum/sumtestutil"
+)
+
+func TestParseIntSWAR(t *testing.T) {
+	inputs := []string{
+		"", "-", "0", "-0", "7", "-7", "12", "123", "1234", "12345", "123456", "1234567", "12345678", "-12345678",
+		"123456789", "9223372036854775807", "-9223372036854775808", "9223372036854775808", "99999999999999999999999",
+		"00000000000000000001", "+1", "--1", "1-", " 1", "1 ", "1\r", "12a4", "/", ":", "\xff1", "1\x80",
+	}
+	// Invalid character at every position of every chunk.
+	for i := 0; i < 20; i++ {
+		for _, c := range []byte{'/', ':', 'a', 0, 0xb0} {
+			in := []byte(strings.Repeat("9", 20))
+			in[i] = c
+			inputs = append(inputs, string(in))
+		}
+	}
+
+	for _, in := range inputs {
+		t.Run(in, func(t *testing.T) {
+			exp, expErr := ParseInt([]byte(in))
+
+			// Both with the capacity smaller than 8 and with garbage after the input, which must be ignored.
+			for _, b := range [][]byte{[]byte(in), append([]byte(in), "9a9-9\n\xff\x00"...)[:len(in)]} {
+				got, err := ParseIntSWAR(b)
+				if expErr != nil {
+					testutil.NotOk(t, err)
+					testutil.Equals(t, expErr.Error(), err.Error())
+					continue
+				}
+				testutil.Ok(t, err)
+				testutil.Equals(t, exp, got)
+			}
+		})
+	}
+}
+
+func FuzzParseIntSWAR(f *testing.F) {
+	for _, in := range []string{"0", "-12345678", "123456789", "12a4", "-", "99999999999999999999999"} {
+		f.Add([]byte(in))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		exp, expErr := ParseInt(in)
+		got, err := ParseIntSWAR(in)
+		if expErr != nil {
+			testutil.NotOk(t, err)
+			return
+		}
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp, got)
+	})
+}
+
+func TestSum_SWAR(t *testing.T) {
+	buf := bytes.Buffer{}
+	expectedSum, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e5)
+	testutil.Ok(t, err)
+	buf.WriteString("\n-1234567890123\n\n42") // Blank lines, long number and final line without newline.
+	expectedSum += -1234567890123 + 42
+
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+	testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+	ret, err := Sum4_swar(testFile)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expectedSum, ret)
+
+	for _, bufSize := range []int{16, 1024} {
+		ret, err = Sum6Reader_swar(bytes.NewReader(buf.Bytes()), make([]byte, bufSize))
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedSum, ret)
+	}
+
+	t.Run("invalid input", func(t *testing.T) {
+		for _, in := range []string{"1\n+2\n", "1\n12a4\n", "1\n-\n", "1\n2\r\n", "1\n 2"} {
+			testutil.Ok(t, os.WriteFile(testFile, []byte(in), os.ModePerm))
+
+			_, expErr := Sum4(testFile)
+			testutil.NotOk(t, expErr)
+
+			_, err := Sum4_swar(testFile)
+			testutil.NotOk(t, err)
+			testutil.Equals(t, expErr.Error(), err.Error())
+
+			_, err = Sum6Reader_swar(strings.NewReader(in), make([]byte, 16))
+			testutil.NotOk(t, err)
+			testutil.Equals(t, expErr.Error(), err.Error())
+		}
+	})
+	t.Run("line longer than buffer", func(t *testing.T) {
+		_, err := Sum6Reader_swar(strings.NewReader("1\n123456789012\n"), make([]byte, 8))
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "line at byte offset 2 is longer than the 8 bytes buffer", err.Error())
+	})
+}
+
+// BenchmarkParseIntSWAR recommended run options:
+// $ export ver=v1swar && go test -run '^$' -bench '^BenchmarkParseIntSWAR$' -benchtime 1s -count 6 -cpu 1 | tee ${ver}.txt
+func BenchmarkParseIntSWAR(b *testing.B) {
+	for _, in := range []string{"123", "26660", "-12345678", "1234567890123456"} {
+		// Sub-slice of bigger buffer, like lines in Sum4.
+		input := []byte(in + "\n")[:len(in)]
+
+		b.Run(in, func(b *testing.B) {
+			b.Run("ParseInt", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, _ = ParseInt(input)
+				}
+			})
+			b.Run("ParseIntSWAR", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, _ = ParseIntSWAR(input)
+				}
+			})
+			b.Run("strconv", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, _ = strconv.ParseInt(zeroCopyToString(input), 10, 64)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSum_SWAR(b *testing.B) {
+	fn := lazyCreateTestInput(b, 2e6)
+
+	for _, tcase := range []struct {
+		name string
+		f    func(string) (int64, error)
+	}{
+		{name: "Sum4", f: Sum4},
+		{name: "Sum4_swar", f: Sum4_swar},
+		{name: "Sum6", f: Sum6},
+		{name: "Sum6_swar", f: func(fn string) (int64, error) {
+			f, err := os.Open(fn)
+			if err != nil {
+				return 0, err
+			}
+			defer func() { _ = f.Close() }()
+			return Sum6Reader_swar(f, make([]byte, 8*1024))
+		}},
+	} {
+		b.Run(tcase.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, err := tcase.f(fn)
+				testutil.Ok(b, err)
+			}
+		})
+	}
+}
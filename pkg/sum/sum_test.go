@@ -4,9 +4,14 @@
 package sum
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"unsafe"
 
@@ -59,6 +64,50 @@ func BenchmarkSum(b *testing.B) {
 	}
 }
 
+// BenchmarkSumMmap compares memory mapped sums with variants that read the whole file on heap.
+// Recommended run options:
+/*
+export ver=v1mmap && go test \
+    -run '^$' -bench '^BenchmarkSumMmap$' \
+    -benchtime 10s -count 6 -cpu 4 -benchmem \
+  | tee ${ver}.txt
+*/
+func BenchmarkSumMmap(b *testing.B) {
+	fn := lazyCreateTestInput(b, 2e6)
+
+	for _, tcase := range []struct {
+		name string
+		f    func(string) (int64, error)
+	}{
+		{name: "Sum4", f: Sum4},
+		{name: "SumMmap", f: SumMmap},
+		{name: "ConcurrentSum3", f: func(fn string) (int64, error) { return ConcurrentSum3(fn, 4) }},
+		{name: "ConcurrentSumMmap", f: func(fn string) (int64, error) { return ConcurrentSumMmap(fn, 4) }},
+	} {
+		b.Run(tcase.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, err := tcase.f(fn)
+				testutil.Ok(b, err)
+			}
+		})
+	}
+}
+
+func TestSumMmap_EmptyFile(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "empty.txt")
+	testutil.Ok(t, os.WriteFile(testFile, nil, os.ModePerm))
+
+	ret, err := SumMmap(testFile)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), ret)
+
+	ret, err = ConcurrentSumMmap(testFile, 4)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), ret)
+}
+
 func createTestInputWithExpectedResult(fn string, numLen int) (sum int64, err error) {
 	if err := os.MkdirAll(filepath.Dir(fn), os.ModePerm); err != nil {
 		return 0, err
@@ -86,7 +135,7 @@ func TestSum(t *testing.T) {
 			f func(string) (int64, error)
 		}{
 			{f: Sum}, {f: Sum2}, {f: Sum2_scanner}, {f: ConcurrentSum1}, {f: Sum3},
-			{f: Sum4}, {f: Sum4_atoi}, {f: Sum5}, {f: Sum5_line}, {f: Sum6}, {f: Sum7},
+			{f: Sum4}, {f: Sum4_atoi}, {f: Sum5}, {f: Sum5_line}, {f: Sum6}, {f: Sum7}, {f: SumMmap}, {f: Sum4_swar},
 		} {
 			t.Run("", func(t *testing.T) {
 				ret, err := tcase.f(testFile)
@@ -99,7 +148,7 @@ func TestSum(t *testing.T) {
 		for _, tcase := range []struct {
 			f func(string, int) (int64, error)
 		}{
-			{f: ConcurrentSum2}, {f: ConcurrentSum3}, {f: ConcurrentSum4},
+			{f: ConcurrentSum2}, {f: ConcurrentSum3}, {f: ConcurrentSum4}, {f: ConcurrentSumMmap},
 		} {
 			t.Run("", func(t *testing.T) {
 				ret, err := tcase.f(testFile, 4)
@@ -114,6 +163,208 @@ func TestSum(t *testing.T) {
 	})
 }
 
+func TestConcurrentSum_InvalidInput(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "input.txt")
+
+	buf := bytes.Buffer{}
+	_, err := sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e4)
+	testutil.Ok(t, err)
+	expectedOffset := int64(buf.Len())
+
+	buf.WriteString("12a4\n")
+	_, err = sumtestutil.CreateTestInputWithExpectedResult(&buf, 1e4)
+	testutil.Ok(t, err)
+	testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+	for _, tcase := range []struct {
+		name string
+		f    func(string, int) (int64, error)
+	}{
+		{name: "ConcurrentSum1", f: func(fn string, _ int) (int64, error) { return ConcurrentSum1(fn) }},
+		{name: "ConcurrentSum2", f: ConcurrentSum2},
+		{name: "ConcurrentSum3", f: ConcurrentSum3},
+		{name: "ConcurrentSum4", f: ConcurrentSum4},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			for _, workers := range []int{1, 4, 11} {
+				_, err := tcase.f(testFile, workers)
+				testutil.NotOk(t, err)
+
+				var pErr *ParseError
+				testutil.Assert(t, errors.As(err, &pErr), "expected ParseError, got %v", err)
+				testutil.Equals(t, expectedOffset, pErr.Offset)
+				testutil.Equals(t, int(1e4)+1, pErr.Line)
+			}
+		})
+	}
+}
+
+// longLinesInput returns input with lines of very different lengths: 19-digit negative numbers, values padded
+// with zeros to up to 134 bytes and a few tiny numbers.
+func longLinesInput(seed int64, lines int) []byte {
+	r := rand.New(rand.NewSource(seed))
+
+	var b []byte
+	for i := 0; i < lines; i++ {
+		switch r.Intn(4) {
+		case 0:
+			b = strconv.AppendInt(b, -1e18-r.Int63n(8e18), 10)
+		case 1:
+			b = append(b, bytes.Repeat([]byte("0"), r.Intn(128))...)
+			b = strconv.AppendInt(b, r.Int63n(1e6), 10)
+		default:
+			b = strconv.AppendInt(b, r.Int63n(10), 10)
+		}
+		b = append(b, '\n')
+	}
+	return b
+}
+
+func TestShardedRange(t *testing.T) {
+	dir := t.TempDir()
+	sumOf := func(t *testing.T, b []byte) int64 {
+		t.Helper()
+
+		fn := filepath.Join(dir, "shard.txt")
+		testutil.Ok(t, os.WriteFile(fn, b, os.ModePerm))
+		ret, err := Sum(fn)
+		testutil.Ok(t, err)
+		return ret
+	}
+
+	for _, tcase := range []struct {
+		name  string
+		input []byte
+	}{
+		{name: "empty", input: []byte{}},
+		{name: "single line", input: []byte("-1234567890123456789\n")},
+		{name: "single unterminated line", input: []byte("-1234567890123456789")},
+		{name: "line longer than shards", input: []byte("1\n" + strings.Repeat("0", 300) + "7\n2\n")},
+		{name: "long lines", input: longLinesInput(1, 50)},
+		{name: "long lines, unterminated", input: bytes.TrimSuffix(longLinesInput(2, 50), []byte("\n"))},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			b := tcase.input
+			expected := sumOf(t, b)
+
+			// Without shardWorkers, so there are shards with less bytes than lines.
+			for workers := 1; workers <= 40; workers++ {
+				var (
+					total int64
+					prev  int
+				)
+				for i := 0; i < workers; i++ {
+					begin, end := shardedRange(i, workers, b)
+					testutil.Equals(t, prev, begin, "worker %v/%v", i, workers)
+					testutil.Assert(t, begin <= end, "worker %v/%v: begin %v > end %v", i, workers, begin, end)
+					testutil.Assert(t, begin == 0 || b[begin-1] == '\n', "worker %v/%v: begin %v is not a line beginning", i, workers, begin)
+
+					rBegin, rEnd, err := shardedRangeFromReaderAt(i, workers, len(b), bytes.NewReader(b))
+					testutil.Ok(t, err)
+					testutil.Equals(t, []int{begin, end}, []int{rBegin, rEnd}, "worker %v/%v", i, workers)
+
+					var stop atomic.Bool
+					sum, err := sumRange(b, begin, end, DefaultFormat, &stop)
+					testutil.Ok(t, err)
+					testutil.Equals(t, sumOf(t, b[begin:end]), sum, "worker %v/%v", i, workers)
+
+					total += sum
+					prev = end
+				}
+				testutil.Equals(t, len(b), prev, "workers %v", workers)
+				testutil.Equals(t, expected, total, "workers %v", workers)
+			}
+		})
+	}
+}
+
+func TestConcurrentSum_LongLinesAndTinyInputs(t *testing.T) {
+	for _, input := range [][]byte{
+		[]byte("1\n"),
+		[]byte("1\n2\n3"),
+		[]byte("-1234567890123456789\n-1234567890123456789\n"),
+		longLinesInput(3, 10),
+		longLinesInput(4, 1e3),
+	} {
+		testFile := filepath.Join(t.TempDir(), "input.txt")
+		testutil.Ok(t, os.WriteFile(testFile, input, os.ModePerm))
+		expected, err := Sum(testFile)
+		testutil.Ok(t, err)
+
+		for _, workers := range []int{1, 2, 3, 7, 11, 64} {
+			for name, f := range map[string]func(string, int) (int64, error){
+				"ConcurrentSum3": ConcurrentSum3, "ConcurrentSum4": ConcurrentSum4,
+				"ConcurrentSumMmap": ConcurrentSumMmap,
+				"ConcurrentSumStats4": func(fn string, workers int) (int64, error) {
+					s, err := ConcurrentSumStats4(fn, workers, nil)
+					if err != nil {
+						return 0, err
+					}
+					return s.Sum, nil
+				},
+			} {
+				ret, err := f(testFile, workers)
+				testutil.Ok(t, err, "%v with %v workers", name, workers)
+				testutil.Equals(t, expected, ret, "%v with %v workers", name, workers)
+			}
+		}
+	}
+}
+
+func TestSum_GeneratedInput(t *testing.T) {
+	for _, cfg := range []sumtestutil.InputConfig{
+		{Seed: 1, Lines: 1e4, Distribution: sumtestutil.Digits, NegativeRatio: 0.5},
+		{Seed: 2, Bytes: 1e5 + 3, Distribution: sumtestutil.Digits, NegativeRatio: 0.1, NoTrailingNewline: true},
+		{Seed: 3, Lines: 1e3 + 7, Distribution: sumtestutil.Full, NegativeRatio: 0.5},
+		// Full values, but few enough for the sum to fit in int64.
+		{Seed: 6, Lines: 8, Distribution: sumtestutil.Full, NegativeRatio: 0.5},
+		{Seed: 4, Bytes: 4e4, Distribution: sumtestutil.Small, NegativeRatio: 0.3, CRLF: true},
+		{Seed: 5, Lines: 1e3, Distribution: sumtestutil.Digits, NegativeRatio: 0.5, CRLF: true, NoTrailingNewline: true},
+	} {
+		t.Run(fmt.Sprintf("%+v", cfg), func(t *testing.T) {
+			buf := bytes.Buffer{}
+			stats, err := sumtestutil.GenerateInput(&buf, cfg)
+			testutil.Ok(t, err)
+			testFile := filepath.Join(t.TempDir(), "input.txt")
+			testutil.Ok(t, os.WriteFile(testFile, buf.Bytes(), os.ModePerm))
+
+			if !stats.SumOverflows {
+				for _, workers := range []int{1, 3, 16} {
+					ret, err := ConcurrentSumWithFormat(testFile, workers, AllowCRLF)
+					testutil.Ok(t, err)
+					testutil.Equals(t, stats.Sum, ret)
+				}
+			}
+			if cfg.CRLF {
+				// CRLF is not in DefaultFormat.
+				_, err := Sum4(testFile)
+				testutil.NotOk(t, err)
+				return
+			}
+
+			s, err := ConcurrentSumStats4(testFile, 3, nil)
+			testutil.Ok(t, err)
+			testutil.Equals(t, []int64{stats.Lines, stats.Min, stats.Max}, []int64{s.Count, s.Min, s.Max})
+			if !stats.SumOverflows {
+				testutil.Equals(t, stats.Sum, s.Sum)
+			}
+
+			for name, f := range conformingSums() {
+				ret, err := f(testFile)
+				if stats.SumOverflows {
+					// Only checked implementations define the result, the rest wraps.
+					if strings.Contains(name, "Checked") {
+						testutil.Assert(t, errors.Is(err, ErrOverflow), "%v: expected overflow error, got %v", name, err)
+					}
+					continue
+				}
+				testutil.Ok(t, err, name)
+				testutil.Equals(t, stats.Sum, ret, name)
+			}
+		})
+	}
+}
+
 // TestBenchSum tests the benchmark (!).
 // Read more in "Efficient Go"; Example 8-11.
 func TestBenchSum(t *testing.T) {
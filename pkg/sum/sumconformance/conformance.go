@@ -0,0 +1,328 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+// Package sumconformance is the conformance suite for implementations summing integers, one per line. Any function
+// with the Sum (file name) or Sum reader (io.Reader) signature can be run against it, so all variants (including
+// the ones outside of this repository) can prove identical behaviour.
+//
+// The behaviour is defined by Reference: each line is a base-10 integer with optional '-' sign (leading zeros are
+// allowed), empty lines are skipped and the final line does not need to be terminated with '\n'. Everything else
+// (spaces, '+' sign, "\r\n", letters, etc.) is invalid and has to return an error.
+//
+// The package does not import github.com/efficientgo/examples/pkg/sum, so its tests can use it.
+package sumconformance
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+// MaxLineLen is the longest line (without '\n') implementations have to support. Buffered implementations can
+// fail on longer lines.
+const MaxLineLen = 1024
+
+// ErrUnspecified is returned by Reference for inputs for which the behaviour is not specified: lines longer than
+// MaxLineLen, integers out of int64 range and sums overflowing int64. Implementations can return any sum (e.g.
+// wrapped) or error for them.
+var ErrUnspecified = errors.New("behaviour unspecified")
+
+// SumFunc sums integers from the file, e.g. sum.Sum4. Implementations with more parameters (e.g. number of workers)
+// can be wrapped in a closure.
+type SumFunc func(fileName string) (int64, error)
+
+// ReaderFunc sums integers from the reader, e.g. sum.Sum6Reader with a fixed buffer.
+type ReaderFunc func(r io.Reader) (int64, error)
+
+// Reference is the reference implementation. It is slow, but straightforward. It returns an error for invalid
+// input and ErrUnspecified (wrapped) for input with unspecified behaviour.
+func Reference(input []byte) (int64, error) {
+	var sum int64
+	for i, line := range bytes.Split(input, []byte("\n")) {
+		if len(line) > MaxLineLen {
+			return 0, errors.Wrapf(ErrUnspecified, "line %v longer than %v", i+1, MaxLineLen)
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		digits := line
+		if digits[0] == '-' {
+			digits = digits[1:]
+		}
+		if len(digits) == 0 {
+			return 0, errors.Newf("line %v: not a valid integer: %q", i+1, line)
+		}
+		for _, d := range digits {
+			if d < '0' || d > '9' {
+				return 0, errors.Newf("line %v: not a valid integer: %q", i+1, line)
+			}
+		}
+
+		num, err := strconv.ParseInt(string(line), 10, 64)
+		if err != nil {
+			// Only possible error at this point is the range error.
+			return 0, errors.Wrapf(ErrUnspecified, "line %v: %v", i+1, err)
+		}
+		if (num > 0 && sum > math.MaxInt64-num) || (num < 0 && sum < math.MinInt64-num) {
+			return 0, errors.Wrapf(ErrUnspecified, "line %v: sum overflows int64", i+1)
+		}
+		sum += num
+	}
+	return sum, nil
+}
+
+// Case is a single conformance case.
+type Case struct {
+	Name  string
+	Input []byte
+	// Invalid is true if implementation has to return an error, otherwise it has to return Expected.
+	Invalid  bool
+	Expected int64
+}
+
+var (
+	generatedOnce  sync.Once
+	generatedCases []Case
+)
+
+// Cases returns all conformance cases. Cases with big inputs are generated once and shared, so don't modify them.
+func Cases() []Case {
+	cases := []Case{
+		{Name: "empty", Input: []byte{}},
+		{Name: "single newline", Input: []byte("\n")},
+		{Name: "blank lines", Input: []byte("\n\n1\n\n\n2\n\n"), Expected: 3},
+		{Name: "single number", Input: []byte("42\n"), Expected: 42},
+		{Name: "missing trailing newline", Input: []byte("1\n2\n42"), Expected: 45},
+		{Name: "single number without newline", Input: []byte("-7"), Expected: -7},
+		{Name: "negative numbers", Input: []byte("-1\n-20\n300\n-4000\n"), Expected: -3721},
+		{Name: "zeros", Input: []byte("0\n-0\n000\n-000\n"), Expected: 0},
+		{Name: "leading zeros", Input: []byte("007\n-0000000000000000000000000000000000000000000000008\n"), Expected: -1},
+		{Name: "max int64", Input: []byte("9223372036854775807\n"), Expected: math.MaxInt64},
+		{Name: "min int64", Input: []byte("-9223372036854775808"), Expected: math.MinInt64},
+		{Name: "max and min int64", Input: []byte("9223372036854775807\n-9223372036854775808\n"), Expected: -1},
+		{Name: "19 digit negatives", Input: []byte("-1234567890123456789\n-1000000000000000000\n"), Expected: -2234567890123456789},
+		{Name: "long line", Input: []byte("1\n" + string(bytes.Repeat([]byte("0"), MaxLineLen-1)) + "5\n2\n"), Expected: 8},
+	}
+
+	for _, in := range []string{
+		"12a4", "a", "-", "--1", "1-", "-+1", "+1", " 1", "1 ", "\t1", "1\r", "0x10", "1.5", "1e3", "1,000",
+		"١", "\x00", "1\x00", "9\xff",
+	} {
+		cases = append(cases,
+			Case{Name: "invalid " + strconv.Quote(in), Input: []byte(in + "\n"), Invalid: true},
+			Case{Name: "invalid " + strconv.Quote(in) + " after valid lines", Input: []byte("1\n2\n3\n" + in + "\n4\n"), Invalid: true},
+			Case{Name: "invalid " + strconv.Quote(in) + " as final line", Input: []byte("1\n2\n3\n" + in), Invalid: true},
+		)
+	}
+	cases = append(cases, Case{Name: "crlf", Input: []byte("1\r\n2\r\n"), Invalid: true})
+
+	generatedOnce.Do(func() { generatedCases = generateCases() })
+	return append(cases, generatedCases...)
+}
+
+// generateCases returns inputs with lines of different lengths, so they have lines crossing all kind of shard
+// and buffer boundaries, for any number of workers and buffer sizes.
+func generateCases() []Case {
+	var cases []Case
+	for _, c := range []struct {
+		name         string
+		seed         int64
+		lines        int
+		maxZeros     int
+		unterminated bool
+		invalid      bool
+	}{
+		{name: "shard boundaries, tiny", seed: 1, lines: 3, maxZeros: 64},
+		{name: "shard boundaries, small", seed: 2, lines: 40, maxZeros: 200},
+		{name: "shard boundaries, small, unterminated", seed: 3, lines: 41, maxZeros: 200, unterminated: true},
+		{name: "shard boundaries, medium", seed: 4, lines: 1e4, maxZeros: 1000},
+		{name: "shard boundaries, medium, invalid", seed: 5, lines: 1e4, maxZeros: 10, invalid: true},
+		{name: "huge", seed: 6, lines: 1e6},
+		{name: "huge, invalid", seed: 7, lines: 1e6, invalid: true},
+	} {
+		r := rand.New(rand.NewSource(c.seed))
+		var (
+			b   []byte
+			sum int64
+		)
+		for i := 0; i < c.lines; i++ {
+			var num int64
+			switch r.Intn(4) {
+			case 0:
+				// Long numbers, but small enough not to overflow the sum.
+				num = r.Int63n(1e15) - 5e14
+			case 1:
+				num = -r.Int63n(1e6)
+			default:
+				num = r.Int63n(1e3)
+			}
+			if c.maxZeros > 0 && r.Intn(4) == 0 {
+				// Pad with zeros, after the sign.
+				if num < 0 {
+					b = append(b, '-')
+				}
+				b = append(b, bytes.Repeat([]byte("0"), r.Intn(c.maxZeros))...)
+				b = strconv.AppendInt(b, abs(num), 10)
+			} else {
+				b = strconv.AppendInt(b, num, 10)
+			}
+			b = append(b, '\n')
+			sum += num
+		}
+		if c.unterminated {
+			b = b[:len(b)-1]
+		}
+		if c.invalid {
+			// Invalid line close to the middle, which is shard boundary for even number of workers.
+			mid := bytes.IndexByte(b[len(b)/2:], '\n') + len(b)/2 + 1
+			b = append(b[:mid:mid], append([]byte("12a4\n"), b[mid:]...)...)
+		}
+		cases = append(cases, Case{Name: c.name, Input: b, Invalid: c.invalid, Expected: sum})
+	}
+	return cases
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func isHuge(c Case) bool { return len(c.Input) > 1024*1024 }
+
+// TestSum runs all conformance cases against the f. Huge cases are skipped in the short mode.
+func TestSum(t *testing.T, f SumFunc) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i, c := range Cases() {
+		t.Run(c.Name, func(t *testing.T) {
+			if testing.Short() && isHuge(c) {
+				t.Skip("huge input in short mode")
+			}
+
+			// Unique file name, so file caches don't return old results.
+			fileName := filepath.Join(dir, strconv.Itoa(i)+".txt")
+			testutil.Ok(t, os.WriteFile(fileName, c.Input, os.ModePerm))
+			defer func() { _ = os.Remove(fileName) }()
+
+			ret, err := f(fileName)
+			checkResult(t, c, ret, err)
+		})
+	}
+}
+
+// TestReader is like TestSum, but for reader implementations.
+func TestReader(t *testing.T, f ReaderFunc) {
+	t.Helper()
+
+	for _, c := range Cases() {
+		t.Run(c.Name, func(t *testing.T) {
+			if testing.Short() && isHuge(c) {
+				t.Skip("huge input in short mode")
+			}
+
+			ret, err := f(bytes.NewReader(c.Input))
+			checkResult(t, c, ret, err)
+
+			// Readers returning a single byte at a time exercise all buffer boundaries.
+			if len(c.Input) <= 64*1024 {
+				ret, err = f(&oneByteReader{r: bytes.NewReader(c.Input)})
+				checkResult(t, c, ret, err)
+			}
+		})
+	}
+}
+
+func checkResult(t *testing.T, c Case, ret int64, err error) {
+	t.Helper()
+
+	if c.Invalid {
+		testutil.NotOk(t, err, "expected error for invalid input")
+		return
+	}
+	testutil.Ok(t, err)
+	testutil.Equals(t, c.Expected, ret)
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.r.Read(p[:1])
+}
+
+// fuzzSeeds adds all small cases as the seed corpus.
+func fuzzSeeds(f *testing.F) {
+	for _, c := range Cases() {
+		if len(c.Input) <= 4*1024 {
+			f.Add(c.Input)
+		}
+	}
+}
+
+// fuzzCheck checks the result against Reference, if the behaviour is specified for the input.
+func fuzzCheck(t *testing.T, input []byte, ret int64, err error) {
+	t.Helper()
+
+	expected, refErr := Reference(input)
+	if errors.Is(refErr, ErrUnspecified) {
+		return
+	}
+	if refErr != nil {
+		testutil.NotOk(t, err, "expected error, reference failed with: %v", refErr)
+		return
+	}
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, ret)
+}
+
+// FuzzSum is the native Go fuzz target comparing f against Reference. Call it from your FuzzXxx function, e.g.:
+//
+//	func FuzzSum4(f *testing.F) { sumconformance.FuzzSum(f, sum.Sum4) }
+func FuzzSum(f *testing.F, fn SumFunc) {
+	fuzzSeeds(f)
+
+	dir := f.TempDir()
+	var (
+		mu sync.Mutex
+		i  int
+	)
+	f.Fuzz(func(t *testing.T, input []byte) {
+		mu.Lock()
+		i++
+		fileName := filepath.Join(dir, strconv.Itoa(i)+".txt")
+		mu.Unlock()
+
+		testutil.Ok(t, os.WriteFile(fileName, input, os.ModePerm))
+		defer func() { _ = os.Remove(fileName) }()
+
+		ret, err := fn(fileName)
+		fuzzCheck(t, input, ret, err)
+	})
+}
+
+// FuzzReader is like FuzzSum, but for reader implementations.
+func FuzzReader(f *testing.F, fn ReaderFunc) {
+	fuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		ret, err := fn(bytes.NewReader(input))
+		fuzzCheck(t, input, ret, err)
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sumconformance
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/efficientgo/core/errors"
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestCases(t *testing.T) {
+	for _, c := range Cases() {
+		t.Run(c.Name, func(t *testing.T) {
+			ret, err := Reference(c.Input)
+			testutil.Assert(t, !errors.Is(err, ErrUnspecified), "case has unspecified behaviour: %v", err)
+			if c.Invalid {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, c.Expected, ret)
+		})
+	}
+}
+
+func TestReference_Unspecified(t *testing.T) {
+	for _, input := range []string{
+		"9223372036854775808\n",
+		"-9223372036854775809",
+		"9223372036854775807\n1\n",
+		"-9223372036854775808\n-1\n",
+		string(bytes.Repeat([]byte("0"), MaxLineLen+1)),
+	} {
+		_, err := Reference([]byte(input))
+		testutil.Assert(t, errors.Is(err, ErrUnspecified), "expected unspecified behaviour for %q, got %v", input, err)
+	}
+}
+
+// TestSum_Reference checks that the suite passes for the reference itself.
+func TestSum_Reference(t *testing.T) {
+	TestReader(t, func(r io.Reader) (int64, error) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		return Reference(b)
+	})
+}
+
+func FuzzReference(f *testing.F) {
+	FuzzReader(f, func(r io.Reader) (int64, error) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		return Reference(b)
+	})
+}
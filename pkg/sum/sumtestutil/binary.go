@@ -0,0 +1,60 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sumtestutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/efficientgo/core/errors"
+)
+
+// Binary format constants. They duplicate the ones from the sum package, which can't be imported here,
+// because sum tests import sumtestutil.
+const (
+	binaryMagic   = "SUMB"
+	binaryVersion = 1
+
+	// BinaryFixed64 is sum.BinaryFixed64.
+	BinaryFixed64 = 1
+	// BinaryVarint is sum.BinaryVarint.
+	BinaryVarint = 2
+)
+
+// binaryTenSet has negatives and numbers of all varint lengths, so it exercises all decoding paths.
+var binaryTenSet = []int64{123, -43, 632, -1 << 40, 2, 1 << 40, 26660, math.MinInt64 + 1, math.MaxInt64, -3411}
+
+// CreateBinaryTestInputWithExpectedResult is like CreateTestInputWithExpectedResult, but it writes numLen
+// integers in the binary format with the given encoding (BinaryFixed64 or BinaryVarint).
+func CreateBinaryTestInputWithExpectedResult(w io.Writer, numLen int, encoding uint8) (sum int64, err error) {
+	if numLen%10 != 0 {
+		return 0, errors.Newf("number of input should be division by 10, got %v", numLen)
+	}
+	if encoding != BinaryFixed64 && encoding != BinaryVarint {
+		return 0, errors.Newf("unsupported binary encoding %v", encoding)
+	}
+
+	var set []byte
+	for _, v := range binaryTenSet {
+		if encoding == BinaryFixed64 {
+			set = binary.LittleEndian.AppendUint64(set, uint64(v))
+		} else {
+			set = binary.AppendVarint(set, v)
+		}
+		sum += v // MinInt64+1 and MaxInt64 cancel out, so it does not overflow.
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write([]byte{binaryMagic[0], binaryMagic[1], binaryMagic[2], binaryMagic[3], binaryVersion, encoding, 0, 0}); err != nil {
+		return 0, err
+	}
+	for i := 0; i < numLen/10; i++ {
+		if _, err := bw.Write(set); err != nil {
+			return 0, err
+		}
+	}
+	return sum * (int64(numLen) / 10), bw.Flush()
+}
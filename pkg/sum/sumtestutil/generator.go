@@ -0,0 +1,246 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sumtestutil
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+
+	"github.com/efficientgo/core/errors"
+)
+
+// Distribution is the distribution of absolute values of generated integers.
+type Distribution int
+
+const (
+	// Small values are uniform in [0, 1000), like the ones in CreateTestInputWithExpectedResult.
+	Small Distribution = iota
+	// Digits values have uniformly distributed number of digits, from 1 to 19. It exercises all parser paths,
+	// and lines of very different lengths are crossing shard and buffer boundaries in different ways.
+	Digits
+	// Full values are uniform in [0, MaxInt64], so most have 19 digits. Sum of more than a few of them usually
+	// does not fit in int64, see InputStats.SumOverflows.
+	Full
+)
+
+// InputConfig configures GenerateInput.
+type InputConfig struct {
+	// Seed makes the input deterministic, the same config always generates the same input.
+	Seed int64
+	// Lines is the number of lines to generate. It's ignored if Bytes is not 0.
+	Lines int
+	// Bytes is the exact size of the input to generate. To get exact size, final lines can have values with
+	// fixed number of digits, regardless of Distribution.
+	Bytes int
+
+	Distribution Distribution
+	// NegativeRatio is the probability of a value being negative, from 0 to 1.
+	NegativeRatio float64
+	// CRLF terminates lines with "\r\n" instead of "\n".
+	CRLF bool
+	// NoTrailingNewline leaves the final line unterminated.
+	NoTrailingNewline bool
+}
+
+// InputStats describes the generated input.
+type InputStats struct {
+	Lines int64
+	Bytes int64
+	// Sum is the exact sum of all values. If it does not fit in int64, SumOverflows is true and Sum is 0, so it's
+	// never mistaken for a wrapped result.
+	Sum          int64
+	SumOverflows bool
+	// Min and Max are 0 if there are no lines.
+	Min, Max  int64
+	Negatives int64
+}
+
+// statsAccumulator accumulates InputStats, with the sum computed exactly.
+type statsAccumulator struct {
+	stats InputStats
+	sum   big.Int
+	v     big.Int
+}
+
+func (a *statsAccumulator) add(v int64) {
+	s := &a.stats
+	if s.Lines == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Lines == 0 || v > s.Max {
+		s.Max = v
+	}
+	if v < 0 {
+		s.Negatives++
+	}
+	s.Lines++
+	a.sum.Add(&a.sum, a.v.SetInt64(v))
+}
+
+// result returns the accumulated stats.
+func (a *statsAccumulator) result() InputStats {
+	s := a.stats
+	s.Sum, s.SumOverflows = 0, !a.sum.IsInt64()
+	if !s.SumOverflows {
+		s.Sum = a.sum.Int64()
+	}
+	return s
+}
+
+// pow10 are powers of 10 fitting int64.
+var pow10 = func() []int64 {
+	p := []int64{1}
+	for i := 1; i < 19; i++ {
+		p = append(p, p[i-1]*10)
+	}
+	return p
+}()
+
+type generator struct {
+	cfg InputConfig
+	r   *rand.Rand
+	w   *bufio.Writer
+	b   []byte
+
+	stats statsAccumulator
+}
+
+func (g *generator) negative() bool {
+	return g.cfg.NegativeRatio > 0 && g.r.Float64() < g.cfg.NegativeRatio
+}
+
+func (g *generator) value() int64 {
+	var v int64
+	switch g.cfg.Distribution {
+	case Digits:
+		digits := 1 + g.r.Intn(19)
+		if digits == 1 {
+			v = g.r.Int63n(10)
+		} else if digits == 19 {
+			v = pow10[18] + g.r.Int63n(math.MaxInt64-pow10[18]+1)
+		} else {
+			v = pow10[digits-1] + g.r.Int63n(pow10[digits]-pow10[digits-1])
+		}
+	case Full:
+		v = g.r.Int63()
+	default:
+		v = g.r.Int63n(1000)
+	}
+	if g.negative() {
+		return -v
+	}
+	return v
+}
+
+// fixedWidthValue returns value which takes exactly width bytes (1 to 19) when formatted.
+func (g *generator) fixedWidthValue(width int) int64 {
+	neg := width > 1 && g.negative()
+	digits := width
+	if neg {
+		digits--
+	}
+
+	v := g.r.Int63n(10)
+	if digits > 1 {
+		v = pow10[digits-1] + g.r.Int63n(pow10[digits-1]*9)
+	} else if neg {
+		// "-0" would be formatted as "0".
+		v = 1 + g.r.Int63n(9)
+	}
+	if neg {
+		return -v
+	}
+	return v
+}
+
+func (g *generator) terminator() []byte {
+	if g.cfg.CRLF {
+		return []byte("\r\n")
+	}
+	return []byte("\n")
+}
+
+func (g *generator) writeLine(v int64, last bool) error {
+	g.b = strconv.AppendInt(g.b[:0], v, 10)
+	if !last || !g.cfg.NoTrailingNewline {
+		g.b = append(g.b, g.terminator()...)
+	}
+	n, err := g.w.Write(g.b)
+	g.stats.stats.Bytes += int64(n)
+	g.stats.add(v)
+	return err
+}
+
+func (g *generator) generateLines() error {
+	for i := 0; i < g.cfg.Lines; i++ {
+		if err := g.writeLine(g.value(), i == g.cfg.Lines-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) generateBytes() error {
+	const maxLineLen = 22 // "-" + 19 digits + "\r\n".
+
+	termLen := len(g.terminator())
+	// Generate as if the final line was terminated, the terminator is just not written.
+	remaining := g.cfg.Bytes
+	if g.cfg.NoTrailingNewline {
+		remaining += termLen
+	}
+	if remaining < termLen+1 {
+		return errors.Newf("can't generate input of %v bytes with all lines terminated with %q", g.cfg.Bytes, g.terminator())
+	}
+
+	for remaining > 2*maxLineLen {
+		before := g.stats.stats.Bytes
+		if err := g.writeLine(g.value(), false); err != nil {
+			return err
+		}
+		remaining -= int(g.stats.stats.Bytes - before)
+	}
+
+	// Fill the rest with fixed width lines, never leaving less than one digit and terminator.
+	for remaining > 0 {
+		width := 12
+		if remaining <= width {
+			width = remaining
+		} else if remaining-width < termLen+1 {
+			width = remaining - (termLen + 1)
+		}
+		remaining -= width
+		if err := g.writeLine(g.fixedWidthValue(width-termLen), remaining == 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateInput writes integers, one per line, according to the config and returns stats of what was written.
+// Unlike CreateTestInputWithExpectedResult, values can have any distribution and number of lines.
+func GenerateInput(w io.Writer, cfg InputConfig) (InputStats, error) {
+	if cfg.Lines < 0 || cfg.Bytes < 0 {
+		return InputStats{}, errors.Newf("lines and bytes can't be negative, got %v and %v", cfg.Lines, cfg.Bytes)
+	}
+	if cfg.NegativeRatio < 0 || cfg.NegativeRatio > 1 {
+		return InputStats{}, errors.Newf("negative ratio has to be in [0, 1], got %v", cfg.NegativeRatio)
+	}
+
+	g := &generator{cfg: cfg, r: rand.New(rand.NewSource(cfg.Seed)), w: bufio.NewWriter(w)}
+	var err error
+	if cfg.Bytes > 0 {
+		err = g.generateBytes()
+	} else {
+		err = g.generateLines()
+	}
+	if err != nil {
+		return InputStats{}, err
+	}
+	return g.stats.result(), g.w.Flush()
+}
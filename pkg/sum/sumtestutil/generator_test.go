@@ -0,0 +1,143 @@
+// Copyright (c) Efficient Go Authors
+// Licensed under the Apache License 2.0.
+
+package sumtestutil
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// parse is the naive parser of the generated input.
+func parse(t *testing.T, input string, crlf bool) (_ InputStats, negRatio float64) {
+	t.Helper()
+
+	var a statsAccumulator
+
+	term := "\n"
+	if crlf {
+		term = "\r\n"
+	}
+	input = strings.TrimSuffix(input, term)
+	if input == "" {
+		return a.result(), 0
+	}
+	for _, line := range strings.Split(input, term) {
+		v, err := strconv.ParseInt(line, 10, 64)
+		testutil.Ok(t, err)
+		testutil.Equals(t, strconv.FormatInt(v, 10), line, "non canonical number")
+		a.add(v)
+	}
+	s := a.result()
+	return s, float64(s.Negatives) / float64(s.Lines)
+}
+
+func TestGenerateInput(t *testing.T) {
+	for _, cfg := range []InputConfig{
+		{},
+		{Lines: 1},
+		{Lines: 1, NoTrailingNewline: true},
+		{Lines: 1e4, Distribution: Small},
+		{Lines: 1e4, Distribution: Digits, NegativeRatio: 0.5},
+		{Lines: 1e4, Distribution: Full, NegativeRatio: 1},
+		{Lines: 1e4, Distribution: Digits, NegativeRatio: 0.2, CRLF: true, NoTrailingNewline: true},
+		{Bytes: 2},
+		{Bytes: 1, NoTrailingNewline: true},
+		{Bytes: 3, CRLF: true},
+		{Bytes: 1, CRLF: true, NoTrailingNewline: true},
+		{Bytes: 13, NegativeRatio: 1},
+		{Bytes: 45, Distribution: Full},
+		{Bytes: 1e5, Distribution: Digits, NegativeRatio: 0.5},
+		{Bytes: 1e5 + 1, Distribution: Full, CRLF: true, NoTrailingNewline: true},
+	} {
+		for seed := int64(0); seed < 3; seed++ {
+			cfg := cfg
+			cfg.Seed = seed
+			t.Run(fmt.Sprintf("%+v", cfg), func(t *testing.T) {
+				buf := bytes.Buffer{}
+				stats, err := GenerateInput(&buf, cfg)
+				testutil.Ok(t, err)
+
+				testutil.Equals(t, int64(buf.Len()), stats.Bytes)
+				if cfg.Bytes > 0 {
+					testutil.Equals(t, cfg.Bytes, buf.Len())
+				} else {
+					testutil.Equals(t, int64(cfg.Lines), stats.Lines)
+				}
+
+				input := buf.String()
+				hasTerminator := stats.Lines > 1 || (stats.Lines == 1 && !cfg.NoTrailingNewline)
+				testutil.Equals(t, cfg.CRLF && hasTerminator, strings.Contains(input, "\r\n"))
+				if len(input) > 0 {
+					testutil.Equals(t, cfg.NoTrailingNewline, !strings.HasSuffix(input, "\n"))
+				}
+
+				parsed, negRatio := parse(t, input, cfg.CRLF)
+				parsed.Bytes = stats.Bytes
+				testutil.Equals(t, parsed, stats)
+				if stats.Lines >= 1e3 {
+					testutil.Assert(t, negRatio > cfg.NegativeRatio-0.05 && negRatio < cfg.NegativeRatio+0.05, "negative ratio %v", negRatio)
+				}
+
+				// Deterministic.
+				again := bytes.Buffer{}
+				_, err = GenerateInput(&again, cfg)
+				testutil.Ok(t, err)
+				testutil.Equals(t, input, again.String())
+			})
+		}
+	}
+}
+
+func TestGenerateInput_Digits(t *testing.T) {
+	buf := bytes.Buffer{}
+	_, err := GenerateInput(&buf, InputConfig{Lines: 1e4, Distribution: Digits})
+	testutil.Ok(t, err)
+
+	lengths := map[int]int{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		lengths[len(line)]++
+	}
+	for digits := 1; digits <= 19; digits++ {
+		testutil.Assert(t, float64(lengths[digits]) > 1e4/19/2, "%v digits numbers: %v", digits, lengths[digits])
+	}
+}
+
+func TestGenerateInput_Invalid(t *testing.T) {
+	for _, cfg := range []InputConfig{
+		{Lines: -1},
+		{Bytes: -1},
+		{Lines: 1, NegativeRatio: 1.1},
+		{Bytes: 1},
+		{Bytes: 2, CRLF: true},
+	} {
+		_, err := GenerateInput(&bytes.Buffer{}, cfg)
+		testutil.NotOk(t, err, "%+v", cfg)
+	}
+}
+
+func TestGenerateInput_SumOverflows(t *testing.T) {
+	// Full values are so big that the sum of 1000 of them overflows int64.
+	stats, err := GenerateInput(&bytes.Buffer{}, InputConfig{Lines: 1e3, Distribution: Full})
+	testutil.Ok(t, err)
+	testutil.Assert(t, stats.SumOverflows)
+	testutil.Equals(t, int64(0), stats.Sum)
+
+	// Intermediate sums overflow, but the final one fits.
+	var a statsAccumulator
+	for _, v := range []int64{math.MaxInt64, math.MaxInt64, -math.MaxInt64, -math.MaxInt64, 5} {
+		a.add(v)
+	}
+	s := a.result()
+	testutil.Assert(t, !s.SumOverflows)
+	testutil.Equals(t, int64(5), s.Sum)
+
+	a.add(math.MaxInt64)
+	testutil.Assert(t, a.result().SumOverflows)
+}